@@ -0,0 +1,310 @@
+// Package config loads the application settings. Values come from, in increasing order
+// of precedence: built-in defaults, a YAML or TOML file, environment variables and
+// command-line flags.
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Providers lists the supported AI providers
+var Providers = []string{"openai", "anthropic", "google"}
+
+// Config holds every setting of the application. The key tag names a setting in config
+// files and flags (as section.key), env names its environment variable and secret marks
+// values that are redacted when the configuration is printed. Secrets can also be read
+// from a file named by <env>_FILE or <key>_file, e.g. for mounted container secrets;
+// lists in such files have one item per line.
+type Config struct {
+	Server        ServerConfig        `key:"server"`
+	Log           LogConfig           `key:"log"`
+	Metrics       MetricsConfig       `key:"metrics"`
+	Database      DatabaseConfig      `key:"database"`
+	AI            AIConfig            `key:"ai"`
+	Auth          AuthConfig          `key:"auth"`
+	Account       AccountConfig       `key:"account"`
+	Mail          MailConfig          `key:"mail"`
+	OIDC          OIDCConfig          `key:"oidc"`
+	Media         MediaConfig         `key:"media"`
+	Encryption    EncryptionConfig    `key:"encryption"`
+	Organizations OrganizationsConfig `key:"organizations"`
+	Transcription TranscriptionConfig `key:"transcription"`
+}
+
+type ServerConfig struct {
+	Host            string        `key:"host" env:"HOST" help:"interface to listen on (default: all)"`
+	Port            int           `key:"port" env:"PORT" help:"port to listen on; 0 picks a free port"`
+	PortFallback    bool          `key:"port_fallback" env:"PORT_FALLBACK" help:"listen on a random port when the port is in use instead of failing"`
+	UnixSocket      string        `key:"unix_socket" env:"UNIX_SOCKET" help:"listen on this Unix domain socket instead of host and port"`
+	AddressFile     string        `key:"address_file" env:"ADDRESS_FILE" help:"write the address actually listened on as JSON to this file, or - for stdout"`
+	PublicBaseURL   string        `key:"public_base_url" env:"PUBLIC_BASE_URL" help:"externally visible base URL for absolute links (default: taken from the request); required for verification emails"`
+	TrustedProxies  []string      `key:"trusted_proxies" env:"TRUSTED_PROXIES" help:"IPs or CIDR ranges of reverse proxies whose X-Forwarded-For is believed (default: none, clients are identified by their connection)"`
+	ShutdownTimeout time.Duration `key:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT" help:"how long running requests may finish on shutdown before extractions are killed"`
+}
+
+type LogConfig struct {
+	Level  string `key:"level" env:"LOG_LEVEL" help:"least severe level logged: debug, info, warn or error"`
+	Format string `key:"format" env:"LOG_FORMAT" help:"log line format: json or text"`
+}
+
+// Log formats
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+type MetricsConfig struct {
+	Enabled bool   `key:"enabled" env:"METRICS_ENABLED" help:"serve Prometheus metrics at /metrics (default: off)"`
+	Token   string `key:"token" env:"METRICS_TOKEN" secret:"true" help:"bearer token scrapers must send (default: none, metrics are public)"`
+}
+
+type DatabaseConfig struct {
+	Path string `key:"path" env:"DATABASE_PATH" help:"SQLite database file"`
+}
+
+type AIConfig struct {
+	Provider           string        `key:"provider" env:"AI_PROVIDER" help:"default AI provider: openai, anthropic or google"`
+	APIKey             string        `key:"api_key" env:"AI_API_KEY" secret:"true" help:"API key of the default provider, used after its provider-specific keys"`
+	OpenAIKeys         []string      `key:"openai_api_keys" env:"OPENAI_API_KEYS" secret:"true" help:"OpenAI API keys"`
+	AnthropicKeys      []string      `key:"anthropic_api_keys" env:"ANTHROPIC_API_KEYS" secret:"true" help:"Anthropic API keys"`
+	GoogleKeys         []string      `key:"google_api_keys" env:"GOOGLE_API_KEYS" secret:"true" help:"Google AI API keys"`
+	KeyStrategy        string        `key:"key_strategy" env:"AI_KEY_STRATEGY" help:"how requests use several keys of a provider: failover (in order) or round_robin"`
+	KeyCooldown        time.Duration `key:"key_cooldown" env:"AI_KEY_COOLDOWN" help:"how long a rate-limited key is skipped"`
+	GoogleModel        string        `key:"google_model" env:"GOOGLE_MODEL" help:"model used with the google provider"`
+	SummaryConcurrency int           `key:"summary_concurrency" env:"SUMMARY_CONCURRENCY" help:"chunks summarized in parallel"`
+}
+
+// Key strategies
+const (
+	KeyStrategyFailover   = "failover"
+	KeyStrategyRoundRobin = "round_robin"
+)
+
+// Keys returns the API keys configured for provider in the order they are tried
+func (c AIConfig) Keys(provider string) []string {
+	var keys []string
+	switch provider {
+	case "openai":
+		keys = slices.Clone(c.OpenAIKeys)
+	case "anthropic":
+		keys = slices.Clone(c.AnthropicKeys)
+	case "google":
+		keys = slices.Clone(c.GoogleKeys)
+	}
+	if provider == c.Provider && c.APIKey != "" && !slices.Contains(keys, c.APIKey) {
+		keys = append(keys, c.APIKey)
+	}
+	return keys
+}
+
+type AuthConfig struct {
+	JWTSecret       string        `key:"jwt_secret" env:"JWT_SECRET" secret:"true" help:"access token signing secret (default: random, sessions do not survive a restart)"`
+	AccessTokenTTL  time.Duration `key:"access_token_ttl" env:"ACCESS_TOKEN_TTL" help:"access token lifetime"`
+	RefreshTokenTTL time.Duration `key:"refresh_token_ttl" env:"REFRESH_TOKEN_TTL" help:"refresh token lifetime"`
+	AdminEmails     []string      `key:"admin_emails" env:"ADMIN_EMAILS" help:"emails of users given the admin role"`
+}
+
+type AccountConfig struct {
+	VerifyEmailTTL       time.Duration `key:"verify_email_ttl" env:"VERIFY_EMAIL_TTL" help:"email verification link lifetime"`
+	ResetPasswordTTL     time.Duration `key:"reset_password_ttl" env:"RESET_PASSWORD_TTL" help:"password reset link lifetime"`
+	PasswordResetURL     string        `key:"password_reset_url" env:"PASSWORD_RESET_URL" help:"frontend page password reset links point at; password reset is disabled without it"`
+	RequireVerifiedEmail bool          `key:"require_verified_email" env:"REQUIRE_VERIFIED_EMAIL" help:"block unverified users from AI endpoints"`
+}
+
+type MailConfig struct {
+	Mailer       string `key:"mailer" env:"MAILER" help:"mail backend: log or smtp"`
+	SMTPHost     string `key:"smtp_host" env:"SMTP_HOST" help:"SMTP server host"`
+	SMTPPort     int    `key:"smtp_port" env:"SMTP_PORT" help:"SMTP server port"`
+	SMTPUsername string `key:"smtp_username" env:"SMTP_USERNAME" help:"SMTP user name"`
+	SMTPPassword string `key:"smtp_password" env:"SMTP_PASSWORD" secret:"true" help:"SMTP password"`
+	From         string `key:"from" env:"MAIL_FROM" help:"sender address"`
+}
+
+type OIDCConfig struct {
+	Issuer         string   `key:"issuer" env:"OIDC_ISSUER" help:"identity provider issuer URL; enables single sign-on with client_id"`
+	ClientID       string   `key:"client_id" env:"OIDC_CLIENT_ID" help:"OAuth client ID"`
+	ClientSecret   string   `key:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true" help:"OAuth client secret for confidential clients"`
+	RedirectURL    string   `key:"redirect_url" env:"OIDC_REDIRECT_URL" help:"callback URL (default: derived from the request)"`
+	Scopes         []string `key:"scopes" env:"OIDC_SCOPES" help:"scopes requested in addition to openid, email and profile"`
+	AllowedDomains []string `key:"allowed_domains" env:"OIDC_ALLOWED_DOMAINS" help:"email domains allowed to sign in (default: any)"`
+}
+
+type MediaConfig struct {
+	FileLinkSecret string        `key:"file_link_secret" env:"FILE_LINK_SECRET" secret:"true" help:"download link signing secret (default: random, links do not survive a restart)"`
+	FileLinkTTL    time.Duration `key:"file_link_ttl" env:"FILE_LINK_TTL" help:"how long generated files can be downloaded"`
+}
+
+type EncryptionConfig struct {
+	Key          string   `key:"key" env:"ENCRYPTION_KEY" secret:"true" help:"base64-encoded 32-byte master key that encrypts users' and organizations' provider keys; storing them is disabled without it"`
+	PreviousKeys []string `key:"previous_keys" env:"ENCRYPTION_PREVIOUS_KEYS" secret:"true" help:"former master keys, still used to decrypt keys stored before a rotation"`
+}
+
+type OrganizationsConfig struct {
+	InviteTTL time.Duration `key:"invite_ttl" env:"INVITE_TTL" help:"invitation lifetime"`
+	InviteURL string        `key:"invite_url" env:"INVITE_URL" help:"frontend page invitation links point at; invites are disabled without it"`
+}
+
+type TranscriptionConfig struct {
+	ChunkSeconds   int `key:"chunk_seconds" env:"TRANSCRIBE_CHUNK_SECONDS" help:"length of the audio chunks sent for transcription"`
+	OverlapSeconds int `key:"overlap_seconds" env:"TRANSCRIBE_OVERLAP_SECONDS" help:"overlap between consecutive chunks"`
+	Concurrency    int `key:"concurrency" env:"TRANSCRIBE_CONCURRENCY" help:"chunks transcribed in parallel"`
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            8080,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: LogFormatJSON,
+		},
+		Database: DatabaseConfig{
+			Path: "users.db",
+		},
+		AI: AIConfig{
+			Provider:           "openai",
+			KeyStrategy:        KeyStrategyFailover,
+			KeyCooldown:        time.Minute,
+			SummaryConcurrency: 4,
+		},
+		Auth: AuthConfig{
+			AccessTokenTTL:  15 * time.Minute,
+			RefreshTokenTTL: 30 * 24 * time.Hour,
+		},
+		Account: AccountConfig{
+			VerifyEmailTTL:   24 * time.Hour,
+			ResetPasswordTTL: time.Hour,
+		},
+		Mail: MailConfig{
+			Mailer:   "log",
+			SMTPPort: 587,
+			From:     "no-reply@localhost",
+		},
+		Media: MediaConfig{
+			FileLinkTTL: time.Hour,
+		},
+		Organizations: OrganizationsConfig{
+			InviteTTL: 7 * 24 * time.Hour,
+		},
+		Transcription: TranscriptionConfig{
+			ChunkSeconds:   600,
+			OverlapSeconds: 5,
+			Concurrency:    4,
+		},
+	}
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key string, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("  %s: %s", key, fmt.Sprintf(format, args...)))
+		}
+	}
+	positive := func(d time.Duration, key string) {
+		check(d > 0, key, "must be a positive duration such as 30m (got %s)", d)
+	}
+	absoluteURL := func(raw string, key string) {
+		if raw == "" {
+			return
+		}
+		u, err := url.Parse(raw)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", key, "must be an absolute http(s) URL (got %q)", raw)
+	}
+
+	check(c.Server.Port >= 0 && c.Server.Port < 65536, "server.port", "must be between 0 and 65535 (got %d)", c.Server.Port)
+	absoluteURL(c.Server.PublicBaseURL, "server.public_base_url")
+	for i, proxy := range c.Server.TrustedProxies {
+		_, prefixErr := netip.ParsePrefix(proxy)
+		_, addrErr := netip.ParseAddr(proxy)
+		check(prefixErr == nil || addrErr == nil, fmt.Sprintf("server.trusted_proxies[%d]", i), "must be an IP address or CIDR range (got %q)", proxy)
+	}
+	positive(c.Server.ShutdownTimeout, "server.shutdown_timeout")
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level", "must be debug, info, warn or error (got %q)", c.Log.Level)
+	check(c.Log.Format == LogFormatJSON || c.Log.Format == LogFormatText, "log.format", "must be json or text (got %q)", c.Log.Format)
+
+	check(c.Database.Path != "", "database.path", "must not be empty")
+
+	check(slices.Contains(Providers, c.AI.Provider), "ai.provider", "must be one of %s (got %q)", strings.Join(Providers, ", "), c.AI.Provider)
+	check(c.AI.KeyStrategy == KeyStrategyFailover || c.AI.KeyStrategy == KeyStrategyRoundRobin,
+		"ai.key_strategy", "must be failover or round_robin (got %q)", c.AI.KeyStrategy)
+	positive(c.AI.KeyCooldown, "ai.key_cooldown")
+	check(c.AI.SummaryConcurrency > 0, "ai.summary_concurrency", "must be positive (got %d)", c.AI.SummaryConcurrency)
+
+	positive(c.Auth.AccessTokenTTL, "auth.access_token_ttl")
+	positive(c.Auth.RefreshTokenTTL, "auth.refresh_token_ttl")
+
+	positive(c.Account.VerifyEmailTTL, "account.verify_email_ttl")
+	positive(c.Account.ResetPasswordTTL, "account.reset_password_ttl")
+	absoluteURL(c.Account.PasswordResetURL, "account.password_reset_url")
+
+	switch c.Mail.Mailer {
+	case "log":
+	case "smtp":
+		check(c.Mail.SMTPHost != "", "mail.smtp_host", "is required when mail.mailer is smtp")
+		check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort < 65536, "mail.smtp_port", "must be between 1 and 65535 (got %d)", c.Mail.SMTPPort)
+		check(c.Mail.From != "", "mail.from", "is required when mail.mailer is smtp")
+	default:
+		check(false, "mail.mailer", "must be log or smtp (got %q)", c.Mail.Mailer)
+	}
+
+	if c.OIDC.Issuer != "" || c.OIDC.ClientID != "" {
+		check(c.OIDC.Issuer != "", "oidc.issuer", "is required when oidc.client_id is set")
+		check(c.OIDC.ClientID != "", "oidc.client_id", "is required when oidc.issuer is set")
+	}
+	absoluteURL(c.OIDC.Issuer, "oidc.issuer")
+	absoluteURL(c.OIDC.RedirectURL, "oidc.redirect_url")
+
+	positive(c.Media.FileLinkTTL, "media.file_link_ttl")
+
+	if c.Encryption.Key == "" && len(c.Encryption.PreviousKeys) > 0 {
+		check(false, "encryption.key", "is required when encryption.previous_keys is set")
+	}
+	for i, key := range append([]string{c.Encryption.Key}, c.Encryption.PreviousKeys...) {
+		if key == "" && i == 0 {
+			continue
+		}
+		name := "encryption.key"
+		if i > 0 {
+			name = fmt.Sprintf("encryption.previous_keys[%d]", i-1)
+		}
+		_, err := MasterKey(key)
+		check(err == nil, name, "must be 32 random bytes encoded as base64, e.g. from: openssl rand -base64 32")
+	}
+
+	positive(c.Organizations.InviteTTL, "organizations.invite_ttl")
+	absoluteURL(c.Organizations.InviteURL, "organizations.invite_url")
+
+	check(c.Transcription.ChunkSeconds > 0, "transcription.chunk_seconds", "must be positive (got %d)", c.Transcription.ChunkSeconds)
+	check(c.Transcription.OverlapSeconds >= 0 && c.Transcription.OverlapSeconds < c.Transcription.ChunkSeconds,
+		"transcription.overlap_seconds", "must be at least 0 and smaller than transcription.chunk_seconds (got %d)", c.Transcription.OverlapSeconds)
+	check(c.Transcription.Concurrency > 0, "transcription.concurrency", "must be positive (got %d)", c.Transcription.Concurrency)
+
+	return errors.Join(errs...)
+}
+
+// MasterKey decodes a base64-encoded 32-byte encryption key
+func MasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key is %d bytes, want 32", len(key))
+	}
+	return key, nil
+}
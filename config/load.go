@@ -0,0 +1,254 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setting is one leaf of Config together with its tags
+type setting struct {
+	key    string
+	env    string
+	help   string
+	secret bool
+	value  reflect.Value
+}
+
+// settings lists the settings of cfg in declaration order
+func settings(cfg *Config) []setting {
+	var list []setting
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Type().Field(i)
+		for j := 0; j < section.Type.NumField(); j++ {
+			field := section.Type.Field(j)
+			list = append(list, setting{
+				key:    section.Tag.Get("key") + "." + field.Tag.Get("key"),
+				env:    field.Tag.Get("env"),
+				help:   field.Tag.Get("help"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  root.Field(i).Field(j),
+			})
+		}
+	}
+	return list
+}
+
+// Load builds the configuration from defaults, the file named by --config or
+// CONFIG_FILE, environment variables and the command-line flags in args, then validates
+// it. It returns flag.ErrHelp when args asked for usage, which has then been printed to
+// output.
+func Load(name string, args []string, output io.Writer) (Config, error) {
+	cfg := Default()
+	list := settings(&cfg)
+
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(output)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file (env CONFIG_FILE)")
+
+	// Flags are applied after the file and the environment, in the order given
+	type flagValue struct {
+		setting setting
+		raw     string
+	}
+	var flags []flagValue
+	for _, s := range list {
+		s := s
+		usage := s.help
+		if s.env != "" {
+			usage += " (env " + s.env + ")"
+		}
+		record := func(raw string) error {
+			flags = append(flags, flagValue{s, raw})
+			return nil
+		}
+		if s.value.Kind() == reflect.Bool {
+			fs.BoolFunc(s.key, usage, record)
+		} else {
+			fs.Func(s.key, usage, record)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, list); err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, s := range list {
+		if s.env == "" {
+			continue
+		}
+		// Empty variables count as unset, as they always have
+		raw, fileName := os.Getenv(s.env), os.Getenv(s.env+"_FILE")
+		switch {
+		case raw != "" && fileName != "" && s.secret:
+			return Config{}, fmt.Errorf("environment variables %s and %s_FILE are both set, use one", s.env, s.env)
+		case raw != "":
+			if err := set(s.value, raw); err != nil {
+				return Config{}, fmt.Errorf("environment variable %s: %w", s.env, err)
+			}
+		case fileName != "" && s.secret:
+			if err := setFromFile(s.value, fileName); err != nil {
+				return Config{}, fmt.Errorf("environment variable %s_FILE: %w", s.env, err)
+			}
+		}
+	}
+
+	for _, f := range flags {
+		if err := set(f.setting.value, f.raw); err != nil {
+			return Config{}, fmt.Errorf("flag -%s: %w", f.setting.key, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// loadFile applies a YAML (.yaml, .yml) or TOML (.toml) file with one table per section
+func loadFile(path string, list []setting) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var doc map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, use .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	byKey := make(map[string]setting, len(list))
+	for _, s := range list {
+		byKey[s.key] = s
+	}
+
+	var errs []error
+	for _, sectionKey := range slices.Sorted(maps.Keys(doc)) {
+		section, ok := doc[sectionKey].(map[string]any)
+		if !ok {
+			errs = append(errs, fmt.Errorf("  %s: must be a table of settings", sectionKey))
+			continue
+		}
+		for _, key := range slices.Sorted(maps.Keys(section)) {
+			value := section[key]
+			if s, ok := byKey[sectionKey+"."+strings.TrimSuffix(key, "_file")]; ok && s.secret && strings.HasSuffix(key, "_file") {
+				if err := setFromFile(s.value, fmt.Sprint(value)); err != nil {
+					errs = append(errs, fmt.Errorf("  %s.%s: %w", sectionKey, key, err))
+				}
+				continue
+			}
+			s, ok := byKey[sectionKey+"."+key]
+			if !ok {
+				errs = append(errs, fmt.Errorf("  %s.%s: unknown setting", sectionKey, key))
+				continue
+			}
+			if err := setFileValue(s.value, value); err != nil {
+				errs = append(errs, fmt.Errorf("  %s: %w", s.key, err))
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config file %s:\n%w", path, errors.Join(errs...))
+	}
+	return nil
+}
+
+// setFileValue sets v from a decoded YAML or TOML value. Lists may be given as
+// sequences; scalars are parsed the same way as environment variables.
+func setFileValue(v reflect.Value, value any) error {
+	if items, ok := value.([]any); ok {
+		if v.Kind() != reflect.Slice {
+			return errors.New("must be a single value, not a list")
+		}
+		list := make([]string, 0, len(items))
+		for _, item := range items {
+			list = append(list, fmt.Sprint(item))
+		}
+		v.Set(reflect.ValueOf(list))
+		return nil
+	}
+	if value == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	return set(v, fmt.Sprint(value))
+}
+
+// setFromFile sets v from the contents of a secret file
+func setFromFile(v reflect.Value, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read secret: %w", err)
+	}
+	return set(v, string(data))
+}
+
+// set parses raw into v. Durations use Go syntax such as "90s" and lists are
+// separated by commas or newlines.
+func set(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q, use a value such as 30m or 24h", raw)
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", raw)
+		}
+		v.SetInt(int64(n))
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q, use true or false", raw)
+		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Slice:
+		var list []string
+		for _, item := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '\n' }) {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
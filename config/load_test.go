@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to name in a temporary directory and returns its path
+func writeFile(t *testing.T, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  port: 9000
+  host: file-host
+log:
+  level: warn
+auth:
+  admin_emails: [file@example.com, second@example.com]
+`)
+	tomlFile := writeFile(t, "config.toml", `
+[server]
+port = 9100
+host = "toml-host"
+`)
+
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		// want changes the defaults into the expected configuration
+		want func(cfg *Config)
+	}{
+		{
+			name: "defaults",
+			want: func(cfg *Config) {},
+		},
+		{
+			name: "file overrides defaults",
+			args: []string{"-config", yamlFile},
+			want: func(cfg *Config) {
+				cfg.Server.Port = 9000
+				cfg.Server.Host = "file-host"
+				cfg.Log.Level = "warn"
+				cfg.Auth.AdminEmails = []string{"file@example.com", "second@example.com"}
+			},
+		},
+		{
+			name: "file named by the environment",
+			env:  map[string]string{"CONFIG_FILE": tomlFile},
+			want: func(cfg *Config) {
+				cfg.Server.Port = 9100
+				cfg.Server.Host = "toml-host"
+			},
+		},
+		{
+			name: "environment overrides the file",
+			env:  map[string]string{"PORT": "9001", "ADMIN_EMAILS": "env@example.com, other@example.com", "LOG_LEVEL": ""},
+			args: []string{"-config", yamlFile},
+			want: func(cfg *Config) {
+				cfg.Server.Port = 9001
+				cfg.Server.Host = "file-host"
+				// An empty variable counts as unset
+				cfg.Log.Level = "warn"
+				cfg.Auth.AdminEmails = []string{"env@example.com", "other@example.com"}
+			},
+		},
+		{
+			name: "flags override the environment",
+			env:  map[string]string{"PORT": "9001", "HOST": "env-host"},
+			args: []string{"-config", yamlFile, "-server.port", "9002", "-metrics.enabled", "-server.port", "9003"},
+			want: func(cfg *Config) {
+				// The last of repeated flags wins
+				cfg.Server.Port = 9003
+				cfg.Server.Host = "env-host"
+				cfg.Log.Level = "warn"
+				cfg.Auth.AdminEmails = []string{"file@example.com", "second@example.com"}
+				cfg.Metrics.Enabled = true
+			},
+		},
+		{
+			name: "durations",
+			env:  map[string]string{"ACCESS_TOKEN_TTL": "5m"},
+			args: []string{"-auth.refresh_token_ttl", "48h"},
+			want: func(cfg *Config) {
+				cfg.Auth.AccessTokenTTL = 5 * time.Minute
+				cfg.Auth.RefreshTokenTTL = 48 * time.Hour
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			cfg, err := Load("app", tt.args, io.Discard)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			want := Default()
+			tt.want(&want)
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("Load = %+v\nwant %+v", cfg, want)
+			}
+		})
+	}
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	jwtSecret := writeFile(t, "jwt", "env-file-secret\n")
+	smtpPassword := writeFile(t, "smtp", "file-key-secret")
+	openAIKeys := writeFile(t, "openai", "sk-one\nsk-two\n\n")
+	configFile := writeFile(t, "config.yaml", `
+mail:
+  smtp_password_file: `+smtpPassword+`
+ai:
+  openai_api_keys_file: `+openAIKeys+`
+`)
+	t.Setenv("JWT_SECRET_FILE", jwtSecret)
+
+	cfg, err := Load("app", []string{"-config", configFile}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Auth.JWTSecret != "env-file-secret" {
+		t.Errorf("JWT secret = %q, want the trimmed contents of JWT_SECRET_FILE", cfg.Auth.JWTSecret)
+	}
+	if cfg.Mail.SMTPPassword != "file-key-secret" {
+		t.Errorf("SMTP password = %q, want the contents of mail.smtp_password_file", cfg.Mail.SMTPPassword)
+	}
+	if want := []string{"sk-one", "sk-two"}; !reflect.DeepEqual(cfg.AI.OpenAIKeys, want) {
+		t.Errorf("OpenAI keys = %q, want %q", cfg.AI.OpenAIKeys, want)
+	}
+
+	// The environment overrides secrets from the config file
+	t.Setenv("SMTP_PASSWORD", "env-secret")
+	if cfg, err = Load("app", []string{"-config", configFile}, io.Discard); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Mail.SMTPPassword != "env-secret" {
+		t.Errorf("SMTP password = %q, want the environment variable", cfg.Mail.SMTPPassword)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     map[string]string
+		file    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "secret and secret file",
+			env:     map[string]string{"JWT_SECRET": "secret", "JWT_SECRET_FILE": "/run/secrets/jwt"},
+			wantErr: "JWT_SECRET and JWT_SECRET_FILE are both set",
+		},
+		{
+			name:    "missing secret file",
+			env:     map[string]string{"JWT_SECRET_FILE": filepath.Join(os.TempDir(), "does-not-exist")},
+			wantErr: "JWT_SECRET_FILE: failed to read secret",
+		},
+		{
+			name:    "file only applies to secrets",
+			file:    "server:\n  host_file: /etc/hostname\n",
+			wantErr: "server.host_file: unknown setting",
+		},
+		{
+			name:    "unknown setting",
+			file:    "server:\n  prot: 80\n",
+			wantErr: "server.prot: unknown setting",
+		},
+		{
+			name:    "section is not a table",
+			file:    "server: 80\n",
+			wantErr: "server: must be a table of settings",
+		},
+		{
+			name:    "list for a single value",
+			file:    "server:\n  host: [a, b]\n",
+			wantErr: "server.host: must be a single value, not a list",
+		},
+		{
+			name:    "invalid environment variable",
+			env:     map[string]string{"PORT": "http"},
+			wantErr: `environment variable PORT: invalid integer "http"`,
+		},
+		{
+			name:    "invalid flag",
+			args:    []string{"-auth.access_token_ttl", "15"},
+			wantErr: `flag -auth.access_token_ttl: invalid duration "15"`,
+		},
+		{
+			name:    "unexpected argument",
+			args:    []string{"serve"},
+			wantErr: `unexpected argument "serve"`,
+		},
+		{
+			name:    "invalid settings are reported together",
+			env:     map[string]string{"PORT": "70000", "LOG_FORMAT": "xml"},
+			wantErr: "server.port: must be between 0 and 65535 (got 70000)\n  log.format: must be json or text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "config.yaml", tt.file)}, args...)
+			}
+			_, err := Load("app", args, io.Discard)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Load error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, err := Load("app", []string{"-config", writeFile(t, "config.json", "{}")}, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), `unsupported format ".json"`) {
+		t.Errorf("Load error = %v, want an unsupported format", err)
+	}
+}
+
+func TestWriteRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Auth.JWTSecret = "jwt-secret"
+	cfg.AI.OpenAIKeys = []string{"sk-one", "sk-two"}
+	cfg.Server.Host = "api.example.com"
+
+	var out bytes.Buffer
+	if err := cfg.Write(&out); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	for _, secret := range []string{"jwt-secret", "sk-one", "sk-two"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("output contains the secret %q:\n%s", secret, out.String())
+		}
+	}
+
+	// The output loads back as a config file
+	path := writeFile(t, "config.yaml", out.String())
+	loaded, err := Load("app", []string{"-config", path}, io.Discard)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Server.Host != "api.example.com" || loaded.Auth.JWTSecret != redacted || len(loaded.AI.OpenAIKeys) != 2 {
+		t.Errorf("loaded %+v, want the written settings", loaded)
+	}
+}
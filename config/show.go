@@ -0,0 +1,80 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "[redacted]"
+
+// Write prints the configuration as YAML that can be used as a config file. Secrets are
+// replaced by a placeholder; unset secrets stay empty so it is visible which are missing.
+func (c Config) Write(w io.Writer) error {
+	doc := &yaml.Node{Kind: yaml.MappingNode}
+	var section *yaml.Node
+	sectionKey := ""
+
+	for _, s := range settings(&c) {
+		prefix, key, _ := strings.Cut(s.key, ".")
+		if prefix != sectionKey {
+			sectionKey = prefix
+			section = &yaml.Node{Kind: yaml.MappingNode}
+			doc.Content = append(doc.Content, scalar(prefix), section)
+		}
+
+		value := &yaml.Node{}
+		var v any = s.value.Interface()
+		switch {
+		case s.secret && s.value.Kind() == reflect.Slice:
+			// Show how many keys are configured but none of them
+			list := make([]string, s.value.Len())
+			for i := range list {
+				list[i] = redacted
+			}
+			v = list
+		case s.secret && !s.value.IsZero():
+			v = redacted
+		case s.value.Type() == durationType:
+			v = s.value.Interface().(interface{ String() string }).String()
+		case s.value.Kind() == reflect.Slice && s.value.Len() == 0:
+			v = []string{}
+		}
+		if err := value.Encode(v); err != nil {
+			return err
+		}
+		if s.help != "" {
+			value.LineComment = s.help
+		}
+		section.Content = append(section.Content, scalar(key), value)
+	}
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Secrets returns the values of every secret setting that is set, so they can be kept
+// out of logs
+func (c Config) Secrets() []string {
+	var values []string
+	for _, s := range settings(&c) {
+		switch {
+		case !s.secret:
+		case s.value.Kind() == reflect.Slice:
+			values = append(values, s.value.Interface().([]string)...)
+		case !s.value.IsZero():
+			values = append(values, s.value.String())
+		}
+	}
+	return values
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
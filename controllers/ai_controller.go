@@ -1,7 +1,12 @@
 package controllers
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"path/filepath"
+	"sample-api/middleware"
+	"strings"
 
 	"sample-api/models"
 	"sample-api/services"
@@ -9,14 +14,25 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// maxAIContentBytes bounds request bodies carrying content to analyze or summarize
+const maxAIContentBytes = 1 << 20
+
 type AIController struct {
-	aiService *services.AIService
+	aiService            *services.AIService
+	transcriptionService *services.TranscriptionService
+	captionService       *services.CaptionService
+	mediaService         *services.MediaService
+	orgService           *services.OrganizationService
 }
 
 // NewAIController creates a new AI controller
-func NewAIController(aiService *services.AIService) *AIController {
+func NewAIController(aiService *services.AIService, transcriptionService *services.TranscriptionService, captionService *services.CaptionService, mediaService *services.MediaService, orgService *services.OrganizationService) *AIController {
 	return &AIController{
-		aiService: aiService,
+		aiService:            aiService,
+		transcriptionService: transcriptionService,
+		captionService:       captionService,
+		mediaService:         mediaService,
+		orgService:           orgService,
 	}
 }
 
@@ -33,8 +49,17 @@ func (ac *AIController) PromptAI(c *gin.Context) {
 		return
 	}
 
+	aiService, err := ac.aiFor(c, req.Provider, req.Model, "")
+	if err != nil {
+		c.JSON(aiServiceErrorStatus(err), models.AIPromptResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
 	// Call AI service
-	response, err := ac.aiService.PromptAI(req.Prompt)
+	response, err := aiService.PromptAI(req.Prompt)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.AIPromptResponse{
 			Success: false,
@@ -42,6 +67,7 @@ func (ac *AIController) PromptAI(c *gin.Context) {
 		})
 		return
 	}
+	ac.recordUsage(c, models.UsageKindPrompt, aiService)
 
 	c.JSON(http.StatusOK, models.AIPromptResponse{
 		Success:  true,
@@ -53,10 +79,13 @@ func (ac *AIController) PromptAI(c *gin.Context) {
 // AnalyzeYouTubeContent handles requests to analyze YouTube content using AI
 func (ac *AIController) AnalyzeYouTubeContent(c *gin.Context) {
 	var req models.AIAnalysisRequest
+	if !bindAnalysisRequest(c, &req) {
+		return
+	}
 
-	// Bind JSON request
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.AIAnalysisResponse{
+	aiService, err := ac.aiFor(c, req.Provider, req.Model, req.Language)
+	if err != nil {
+		c.JSON(aiServiceErrorStatus(err), models.AIAnalysisResponse{
 			Success: false,
 			Error:   err.Error(),
 		})
@@ -64,7 +93,12 @@ func (ac *AIController) AnalyzeYouTubeContent(c *gin.Context) {
 	}
 
 	// Call AI service
-	response, err := ac.aiService.AnalyzeYouTubeContent(req.Content)
+	user, _ := middleware.CurrentUser(c)
+	analysisTypes := user.Preferences.AnalysisTypes
+	if req.AnalysisType != "" {
+		analysisTypes = strings.Split(req.AnalysisType, ",")
+	}
+	response, err := aiService.AnalyzeYouTubeContent(req.Content, analysisTypes)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.AIAnalysisResponse{
 			Success: false,
@@ -72,6 +106,7 @@ func (ac *AIController) AnalyzeYouTubeContent(c *gin.Context) {
 		})
 		return
 	}
+	ac.recordUsage(c, models.UsageKindAnalyze, aiService)
 
 	c.JSON(http.StatusOK, models.AIAnalysisResponse{
 		Success:  true,
@@ -83,32 +118,320 @@ func (ac *AIController) AnalyzeYouTubeContent(c *gin.Context) {
 // GenerateSummary handles requests to generate a summary using AI
 func (ac *AIController) GenerateSummary(c *gin.Context) {
 	var req models.AIAnalysisRequest
+	if !bindAnalysisRequest(c, &req) {
+		return
+	}
 
-	// Bind JSON request
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, models.AIAnalysisResponse{
+	// Get summary length from query param (short, medium, long), then the user's preference
+	user, _ := middleware.CurrentUser(c)
+	length := c.Query("length")
+	if length == "" {
+		length = user.Preferences.SummaryLength
+	}
+	if length == "" {
+		length = "medium"
+	}
+
+	aiService, err := ac.aiFor(c, req.Provider, req.Model, req.Language)
+	if err != nil {
+		c.JSON(aiServiceErrorStatus(err), models.AIAnalysisResponse{
 			Success: false,
 			Error:   err.Error(),
 		})
 		return
 	}
 
-	// Get summary length from query param (short, medium, long)
-	length := c.DefaultQuery("length", "medium")
-
 	// Call AI service
-	response, err := ac.aiService.GenerateSummary(req.Content, length)
+	result, err := aiService.GenerateSummary(req.Content, length)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.AIAnalysisResponse{
+		c.JSON(aiServiceErrorStatus(err), models.AIAnalysisResponse{
 			Success: false,
 			Error:   err.Error(),
 		})
 		return
 	}
+	ac.recordUsage(c, models.UsageKindSummarize, aiService)
 
 	c.JSON(http.StatusOK, models.AIAnalysisResponse{
 		Success:  true,
 		Message:  "Summary generated successfully",
-		Analysis: response,
+		Analysis: result.Summary,
+		Strategy: result.Strategy,
+		Chunks:   result.Chunks,
+	})
+}
+
+// TranscribeAudio handles requests to transcribe a previously extracted audio file
+func (ac *AIController) TranscribeAudio(c *gin.Context) {
+	var req models.TranscribeRequest
+
+	// Bind JSON request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.TranscribeResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	org, _, _ := middleware.CurrentOrganization(c)
+	file, err := ac.mediaService.Get(req.FileID, user, org.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrMediaNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.TranscribeResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	language := req.Language
+	if language == "" {
+		language = user.Preferences.Language
+	}
+	transcript, provider, err := ac.transcript(c, file, language)
+	if err != nil {
+		c.JSON(aiServiceErrorStatus(err), models.TranscribeResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+	recordUsage(c, ac.orgService, models.UsageKindTranscribe, provider)
+
+	c.JSON(http.StatusOK, models.TranscribeResponse{
+		Success:    true,
+		Message:    "Audio transcribed successfully",
+		Transcript: transcript,
+	})
+}
+
+// GenerateCaptions handles requests to turn a stored audio file into SRT or WebVTT captions
+func (ac *AIController) GenerateCaptions(c *gin.Context) {
+	var req models.CaptionRequest
+
+	// Bind JSON request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.CaptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	format := req.Format
+	if format == "" {
+		format = "srt"
+	}
+
+	user, _ := middleware.CurrentUser(c)
+	org, _, _ := middleware.CurrentOrganization(c)
+	audioFile, err := ac.mediaService.Get(req.FileID, user, org.ID)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, services.ErrMediaNotFound) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, models.CaptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	spokenLanguage := req.Language
+	if spokenLanguage == "" {
+		spokenLanguage = user.Preferences.Language
+	}
+	transcript, provider, err := ac.transcript(c, audioFile, spokenLanguage)
+	if err != nil {
+		c.JSON(aiServiceErrorStatus(err), models.CaptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	segments := transcript.Segments
+	language := transcript.Language
+	if req.TranslateTo != "" {
+		// Translation is a chat request, so it goes to the user's own provider
+		aiService, err := ac.aiFor(c, "", "", "")
+		if err != nil {
+			c.JSON(aiServiceErrorStatus(err), models.CaptionResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		segments, err = ac.captionService.WithAIService(aiService).Translate(segments, req.TranslateTo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.CaptionResponse{
+				Success: false,
+				Error:   "Failed to translate captions: " + err.Error(),
+			})
+			return
+		}
+		language = req.TranslateTo
+		if provider == "" {
+			provider = aiService.ProviderName()
+		}
+	}
+
+	captionPath, cues, err := ac.captionService.Export(audioFile.Path, segments, format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.CaptionResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	contentType := "application/x-subrip"
+	if format == "vtt" {
+		contentType = "text/vtt"
+	}
+	filename := strings.TrimSuffix(audioFile.Filename, filepath.Ext(audioFile.Filename)) + "." + format
+
+	file, err := ac.mediaService.Register(captionPath, filename, contentType, user.ID, org.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.CaptionResponse{
+			Success: false,
+			Error:   "Failed to store captions: " + err.Error(),
+		})
+		return
+	}
+	recordUsage(c, ac.orgService, models.UsageKindCaptions, provider)
+
+	c.JSON(http.StatusOK, models.CaptionResponse{
+		Success:   true,
+		Message:   "Captions generated successfully",
+		FileID:    file.ID,
+		FileURL:   ac.mediaService.SignedURL(baseURL(c), file),
+		ExpiresAt: &file.ExpiresAt,
+		Format:    format,
+		Language:  language,
+		Cues:      cues,
 	})
 }
+
+// aiFor returns the AI service for the current organization. provider, model and
+// language come from the request and fall back to the user's preferences.
+func (ac *AIController) aiFor(c *gin.Context, provider string, model string, language string) (*services.AIService, error) {
+	user, _ := middleware.CurrentUser(c)
+	org, _, _ := middleware.CurrentOrganization(c)
+	prefs := user.Preferences
+
+	if provider == "" {
+		provider = prefs.Provider
+	}
+	// A preferred model only makes sense for the preferred provider. Preferences saved
+	// with a model but no provider say nothing about which provider it belongs to.
+	if model == "" && prefs.Provider != "" && provider == prefs.Provider {
+		model = prefs.Model
+	}
+	if language == "" {
+		language = prefs.Language
+	}
+
+	aiService, err := ac.orgService.AIServiceFor(org, user.ID, ac.aiService, provider, model)
+	if err != nil {
+		return nil, err
+	}
+	aiService = aiService.WithContext(c.Request.Context())
+	if language != "" {
+		aiService = aiService.WithLanguage(language)
+	}
+	return aiService, nil
+}
+
+// transcriberFor returns the AI service audio is transcribed with. The user's preferred
+// provider and model are for chat and do not apply: only one provider transcribes.
+func (ac *AIController) transcriberFor(c *gin.Context) (*services.AIService, error) {
+	user, _ := middleware.CurrentUser(c)
+	org, _, _ := middleware.CurrentOrganization(c)
+
+	aiService, err := ac.orgService.AIServiceFor(org, user.ID, ac.aiService, services.TranscriptionProvider, "")
+	if err != nil {
+		return nil, err
+	}
+	return aiService.WithContext(c.Request.Context()), nil
+}
+
+// transcript returns the transcript of file, transcribing it only when it has not been
+// transcribed with the same language hint before. provider is the provider that was
+// called for it, or empty when the stored transcript was used.
+func (ac *AIController) transcript(c *gin.Context, file models.MediaFile, language string) (*models.Transcript, string, error) {
+	if file.Transcript != nil && file.TranscriptLanguage == language {
+		return file.Transcript, "", nil
+	}
+
+	transcriber, err := ac.transcriberFor(c)
+	if err != nil {
+		return nil, "", err
+	}
+	transcript, err := ac.transcriptionService.WithAIService(transcriber).Transcribe(file.Path, language)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ac.mediaService.SaveTranscript(file, language, transcript); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to store transcript", "file_id", file.ID, "error", err)
+	}
+	return transcript, transcriber.ProviderName(), nil
+}
+
+// recordUsage meters a successful request against the current organization, completing
+// the quota reserved for it. Failing to record is logged rather than failing a request
+// that has already been served.
+func (ac *AIController) recordUsage(c *gin.Context, kind string, aiService *services.AIService) {
+	recordUsage(c, ac.orgService, kind, aiService.ProviderName())
+}
+
+func recordUsage(c *gin.Context, orgService *services.OrganizationService, kind string, provider string) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	reservation, ok := middleware.UsageReservation(c)
+	if !ok {
+		slog.ErrorContext(c.Request.Context(), "Metered route has no quota reservation", "kind", kind, "organization_id", org.ID)
+		return
+	}
+	if err := orgService.CompleteUsage(reservation, kind, provider); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record usage", "kind", kind, "organization_id", org.ID, "error", err)
+	}
+}
+
+func aiServiceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider), errors.Is(err, services.ErrUnknownModel):
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrMissingCredential), errors.Is(err, services.ErrUnknownMasterKey):
+		return http.StatusConflict
+	case errors.Is(err, services.ErrEncryptionDisabled):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, services.ErrContentTooLarge):
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+// bindAnalysisRequest binds a request with content to analyze, rejecting bodies over
+// maxAIContentBytes with 413
+func bindAnalysisRequest(c *gin.Context, req *models.AIAnalysisRequest) bool {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAIContentBytes)
+	if err := c.ShouldBindJSON(req); err != nil {
+		status := http.StatusBadRequest
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+		c.JSON(status, models.AIAnalysisResponse{
+			Success: false,
+			Error:   err.Error(),
+		})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sample-api/middleware"
+	"sample-api/models"
+	"sample-api/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyController struct {
+	apiKeyService *services.APIKeyService
+}
+
+func NewAPIKeyController(apiKeyService *services.APIKeyService) *APIKeyController {
+	return &APIKeyController{
+		apiKeyService: apiKeyService,
+	}
+}
+
+func (kc *APIKeyController) ListAPIKeys(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	keys, err := kc.apiKeyService.List(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve API keys"})
+		return
+	}
+	c.JSON(http.StatusOK, keys)
+}
+
+func (kc *APIKeyController) CreateAPIKey(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	var req models.CreateAPIKeyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	key, plaintext, err := kc.apiKeyService.Create(user.ID, req.Label, req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	c.JSON(http.StatusCreated, models.CreateAPIKeyResponse{APIKey: key, Key: plaintext})
+}
+
+func (kc *APIKeyController) UpdateAPIKey(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	id, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateAPIKeyRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	key, err := kc.apiKeyService.UpdateLabel(user.ID, id, req.Label)
+	if err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, key)
+}
+
+func (kc *APIKeyController) RevokeAPIKey(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	id, ok := apiKeyID(c)
+	if !ok {
+		return
+	}
+	if err := kc.apiKeyService.Revoke(user.ID, id); err != nil {
+		respondAPIKeyError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func apiKeyID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("keyId"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondAPIKeyError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrAPIKeyNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process API key request"})
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sample-api/middleware"
+	"sample-api/models"
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthController struct {
+	authService    *services.AuthService
+	accountService *services.AccountService
+}
+
+func NewAuthController(authService *services.AuthService, accountService *services.AccountService) *AuthController {
+	return &AuthController{
+		authService:    authService,
+		accountService: accountService,
+	}
+}
+
+func (ac *AuthController) Register(c *gin.Context) {
+	var req models.RegisterRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	tokens, err := ac.authService.Register(req)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	// The account is usable right away; a failed email can be resent later
+	if err := ac.accountService.SendVerification(*tokens.User); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to send verification email", "user_id", tokens.User.ID, "error", err)
+	}
+	c.JSON(http.StatusCreated, tokens)
+}
+
+func (ac *AuthController) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	tokens, err := ac.authService.Login(req.Email, req.Password)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (ac *AuthController) Refresh(c *gin.Context) {
+	var req models.RefreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	tokens, err := ac.authService.Refresh(req.RefreshToken)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func (ac *AuthController) Logout(c *gin.Context) {
+	var req models.RefreshRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := ac.authService.Logout(req.RefreshToken); err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ResendVerification sends a new verification email to the authenticated user
+func (ac *AuthController) ResendVerification(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	if user.EmailVerifiedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email address is already verified"})
+		return
+	}
+	err := ac.accountService.SendVerification(user)
+	if errors.Is(err, services.ErrEmailLinksDisabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to send verification email", "user_id", user.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// VerifyEmail confirms an email address; the token comes from the emailed link's query
+// string or from a JSON body
+func (ac *AuthController) VerifyEmail(c *gin.Context) {
+	var req models.VerifyEmailRequest
+	if err := c.ShouldBind(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	user, err := ac.accountService.VerifyEmail(req.Token)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// ForgotPassword emails a password reset link. It answers 202 whether or not the
+// account exists so callers cannot tell, and 503 when password reset is disabled.
+func (ac *AuthController) ForgotPassword(c *gin.Context) {
+	var req models.ForgotPasswordRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	err := ac.accountService.RequestPasswordReset(req.Email)
+	if errors.Is(err, services.ErrPasswordResetDisabled) {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to send password reset email", "error", err)
+	}
+	c.Status(http.StatusAccepted)
+}
+
+func (ac *AuthController) ResetPassword(c *gin.Context) {
+	var req models.ResetPasswordRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if err := ac.accountService.ResetPassword(req.Token, req.Password); err != nil {
+		respondAuthError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// Me returns the authenticated user
+func (ac *AuthController) Me(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	c.JSON(http.StatusOK, user)
+}
+
+// respondAuthError maps auth service errors to HTTP status codes
+func respondAuthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials), errors.Is(err, services.ErrInvalidToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process authentication request"})
+	}
+}
@@ -0,0 +1,48 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sample-api/middleware"
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type FileController struct {
+	mediaService *services.MediaService
+}
+
+func NewFileController(mediaService *services.MediaService) *FileController {
+	return &FileController{
+		mediaService: mediaService,
+	}
+}
+
+// DownloadFile serves a stored file to anyone holding a valid, unexpired signed link
+func (fc *FileController) DownloadFile(c *gin.Context) {
+	file, err := fc.mediaService.Resolve(c.Param("id"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidSignature):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrLinkExpired):
+			c.JSON(http.StatusGone, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrMediaNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve file"})
+		}
+		return
+	}
+
+	if file.ContentType != "" {
+		c.Header("Content-Type", file.ContentType)
+	}
+	c.FileAttachment(file.Path, file.Filename)
+}
+
+// baseURL returns the externally visible base URL used to build absolute links
+func baseURL(c *gin.Context) string {
+	return middleware.BaseURL(c)
+}
@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"sample-api/models"
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OIDCController struct {
+	oidcService *services.OIDCService
+}
+
+func NewOIDCController(oidcService *services.OIDCService) *OIDCController {
+	return &OIDCController{
+		oidcService: oidcService,
+	}
+}
+
+// Login redirects the browser to the identity provider
+func (oc *OIDCController) Login(c *gin.Context) {
+	authURL, err := oc.oidcService.AuthURL(baseURL(c) + "/auth/oidc/callback")
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Callback is where the identity provider sends the browser back; it returns a token pair
+func (oc *OIDCController) Callback(c *gin.Context) {
+	var req models.OIDCCallbackRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err)
+		return
+	}
+	if req.Error != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": req.Error, "error_description": req.ErrorDescription})
+		return
+	}
+	if req.Code == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code is required"})
+		return
+	}
+
+	tokens, err := oc.oidcService.Callback(c.Request.Context(), req.State, req.Code)
+	if err != nil {
+		respondOIDCError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func respondOIDCError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOIDCDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOIDCEmailRequired), errors.Is(err, services.ErrOIDCDomain):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOIDCLogin), errors.Is(err, services.ErrInvalidToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEmailTaken):
+		// The email belongs to a deleted account
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		slog.ErrorContext(c.Request.Context(), "OIDC login failed", "error", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to sign in with the identity provider"})
+	}
+}
@@ -0,0 +1,270 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"sample-api/middleware"
+	"sample-api/models"
+	"sample-api/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OrganizationController struct {
+	orgService *services.OrganizationService
+}
+
+func NewOrganizationController(orgService *services.OrganizationService) *OrganizationController {
+	return &OrganizationController{
+		orgService: orgService,
+	}
+}
+
+// ListOrganizations returns the caller's organizations and their role in each
+func (oc *OrganizationController) ListOrganizations(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	memberships, err := oc.orgService.ListForUser(user.ID)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, memberships)
+}
+
+func (oc *OrganizationController) CreateOrganization(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	var req models.CreateOrganizationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	org, err := oc.orgService.CreateOrganization(user, req.Name)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, org)
+}
+
+func (oc *OrganizationController) GetOrganization(c *gin.Context) {
+	org, role, _ := middleware.CurrentOrganization(c)
+	c.JSON(http.StatusOK, gin.H{"organization": org, "role": role})
+}
+
+func (oc *OrganizationController) UpdateOrganization(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	var req models.UpdateOrganizationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	org, err := oc.orgService.UpdateOrganization(org, req)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+// UpdateQuota sets the organization's monthly request quota (server admins only)
+func (oc *OrganizationController) UpdateQuota(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	var req models.UpdateQuotaRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	org, err := oc.orgService.SetQuota(org, req.MonthlyRequestQuota)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, org)
+}
+
+func (oc *OrganizationController) ListMembers(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	members, err := oc.orgService.ListMembers(org.ID)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, members)
+}
+
+func (oc *OrganizationController) UpdateMember(c *gin.Context) {
+	org, role, _ := middleware.CurrentOrganization(c)
+	userID, ok := pathID(c, "userId")
+	if !ok {
+		return
+	}
+	var req models.UpdateMembershipRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	membership, err := oc.orgService.UpdateMemberRole(org.ID, userID, req.Role, role)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, membership)
+}
+
+// RemoveMember removes a member; any member may leave by removing themselves
+func (oc *OrganizationController) RemoveMember(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	org, role, _ := middleware.CurrentOrganization(c)
+	userID, ok := pathID(c, "userId")
+	if !ok {
+		return
+	}
+	if err := oc.orgService.RemoveMember(org.ID, userID, user, role); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (oc *OrganizationController) ListInvites(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	invites, err := oc.orgService.ListInvites(org.ID)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, invites)
+}
+
+func (oc *OrganizationController) CreateInvite(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	org, _, _ := middleware.CurrentOrganization(c)
+	var req models.CreateInviteRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	invite, err := oc.orgService.CreateInvite(org, user, req)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, invite)
+}
+
+func (oc *OrganizationController) RevokeInvite(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	inviteID, ok := pathID(c, "inviteId")
+	if !ok {
+		return
+	}
+	if err := oc.orgService.RevokeInvite(org.ID, inviteID); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// AcceptInvite joins the organization an invite was sent for
+func (oc *OrganizationController) AcceptInvite(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	var req models.AcceptInviteRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	membership, err := oc.orgService.AcceptInvite(user, req.Token)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, membership)
+}
+
+func (oc *OrganizationController) ListCredentials(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	credentials, err := oc.orgService.ListCredentials(org.ID)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, credentials)
+}
+
+func (oc *OrganizationController) SetCredential(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	var req models.SetCredentialRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	credential, err := oc.orgService.SetCredential(org.ID, c.Param("provider"), req)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, credential)
+}
+
+func (oc *OrganizationController) DeleteCredential(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+	if err := oc.orgService.DeleteCredential(org.ID, c.Param("provider")); err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// GetUsage counts the organization's requests per kind. from and to are RFC 3339
+// timestamps and default to the current calendar month.
+func (oc *OrganizationController) GetUsage(c *gin.Context) {
+	org, _, _ := middleware.CurrentOrganization(c)
+
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := from.AddDate(0, 1, 0)
+	if t, err := parseQueryTime(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if t != nil {
+		from = *t
+	}
+	if t, err := parseQueryTime(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	} else if t != nil {
+		to = *t
+	}
+
+	summary, err := oc.orgService.Usage(org, from, to)
+	if err != nil {
+		respondOrganizationError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// pathID parses a numeric path parameter, responding with 400 when it is invalid
+func pathID(c *gin.Context, name string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(name), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + name})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func respondOrganizationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrOrganizationNotFound), errors.Is(err, services.ErrMemberNotFound),
+		errors.Is(err, services.ErrInviteNotFound), errors.Is(err, services.ErrCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrOrgForbidden), errors.Is(err, services.ErrInviteEmailMismatch):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrLastOwner), errors.Is(err, services.ErrAlreadyMember):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnknownProvider), errors.Is(err, services.ErrUnknownModel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEncryptionDisabled), errors.Is(err, services.ErrInvitesDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process organization request"})
+	}
+}
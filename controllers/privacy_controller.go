@@ -0,0 +1,69 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"sample-api/middleware"
+	"sample-api/models"
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PrivacyController struct {
+	privacyService *services.PrivacyService
+}
+
+func NewPrivacyController(privacyService *services.PrivacyService) *PrivacyController {
+	return &PrivacyController{
+		privacyService: privacyService,
+	}
+}
+
+// ExportMyData streams a zip archive of everything stored about the current user
+func (pc *PrivacyController) ExportMyData(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+
+	filename := fmt.Sprintf("user-%d-export-%s.zip", user.ID, time.Now().UTC().Format("20060102"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+
+	// Headers are already sent, so a failure can only be logged and the archive left truncated
+	if err := pc.privacyService.Export(user.ID, c.Writer); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to export user data", "user_id", user.ID, "error", err)
+	}
+}
+
+// EraseUser permanently erases a user's personal data. The request must repeat the
+// account's email address as confirmation.
+func (pc *PrivacyController) EraseUser(c *gin.Context) {
+	id, ok := accessibleUserID(c)
+	if !ok {
+		return
+	}
+	var req models.EraseUserRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	actor, _ := middleware.CurrentUser(c)
+	record, err := pc.privacyService.Erase(id, actor.ID, req.Confirm)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrErasureNotConfirmed):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "confirmation_mismatch"})
+		case errors.Is(err, services.ErrLastOwner):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			respondUserError(c, err)
+		}
+		return
+	}
+	c.JSON(http.StatusOK, record)
+}
@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"fmt"
+	"sample-api/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindListQuery reads the standard list parameters: limit, offset, cursor, sort,
+// created_after, created_before and any other query parameter as a filter
+func bindListQuery(c *gin.Context) (services.ListQuery, error) {
+	q := services.ListQuery{
+		Cursor:  c.Query("cursor"),
+		Sort:    c.Query("sort"),
+		Filters: map[string]string{},
+	}
+
+	var err error
+	if raw := c.Query("limit"); raw != "" {
+		if q.Limit, err = strconv.Atoi(raw); err != nil || q.Limit < 1 {
+			return q, fmt.Errorf("limit must be a positive integer")
+		}
+	}
+	if raw := c.Query("offset"); raw != "" {
+		if q.Offset, err = strconv.Atoi(raw); err != nil || q.Offset < 0 {
+			return q, fmt.Errorf("offset must be a non-negative integer")
+		}
+	}
+	if q.CreatedAfter, err = parseQueryTime(c, "created_after"); err != nil {
+		return q, err
+	}
+	if q.CreatedBefore, err = parseQueryTime(c, "created_before"); err != nil {
+		return q, err
+	}
+
+	for key, values := range c.Request.URL.Query() {
+		switch key {
+		case "limit", "offset", "cursor", "sort", "created_after", "created_before":
+		default:
+			q.Filters[key] = values[0]
+		}
+	}
+
+	return q, nil
+}
+
+// parseQueryTime accepts an RFC 3339 timestamp or a plain YYYY-MM-DD date
+func parseQueryTime(c *gin.Context, name string) (*time.Time, error) {
+	raw := c.Query(name)
+	if raw == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateOnly} {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s must be an RFC 3339 timestamp or YYYY-MM-DD date", name)
+}
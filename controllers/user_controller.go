@@ -1,9 +1,12 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
+	"sample-api/middleware"
 	"sample-api/models"
 	"sample-api/services"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,24 +22,166 @@ func NewUserController(userService *services.UserService) *UserController {
 }
 
 func (uc *UserController) GetUsers(c *gin.Context) {
-	users, err := uc.userService.GetUsers()
+	q, err := bindListQuery(c)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	page, err := uc.userService.ListUsers(q)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
 		return
 	}
-	c.JSON(http.StatusOK, users)
+	c.JSON(http.StatusOK, page)
+}
+
+func (uc *UserController) GetUser(c *gin.Context) {
+	id, ok := accessibleUserID(c)
+	if !ok {
+		return
+	}
+	user, err := uc.userService.GetUser(id)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
 }
 
 func (uc *UserController) CreateUser(c *gin.Context) {
-	var user models.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var req models.CreateUserRequest
+	if !bindJSON(c, &req) {
 		return
 	}
-	createdUser, err := uc.userService.CreateUser(user)
+	createdUser, err := uc.userService.CreateUser(models.User{Name: req.Name, Email: req.Email, Role: req.Role})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		respondUserError(c, err)
 		return
 	}
 	c.JSON(http.StatusCreated, createdUser)
 }
+
+func (uc *UserController) UpdateUser(c *gin.Context) {
+	id, ok := accessibleUserID(c)
+	if !ok {
+		return
+	}
+	var req models.UpdateUserRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	if currentUser, _ := middleware.CurrentUser(c); req.Role != nil && !services.HasPermission(currentUser.Role, services.PermUsersManage) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only admins can change roles"})
+		return
+	}
+	user, err := uc.userService.UpdateUser(id, req)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// GetPreferences returns the caller's AI preferences
+func (uc *UserController) GetPreferences(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	c.JSON(http.StatusOK, user.Preferences)
+}
+
+// UpdatePreferences replaces the caller's AI preferences; omitted fields are cleared
+func (uc *UserController) UpdatePreferences(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	var prefs models.UserPreferences
+	if !bindJSON(c, &prefs) {
+		return
+	}
+	prefs, err := uc.userService.UpdatePreferences(user.ID, prefs)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, prefs)
+}
+
+func (uc *UserController) DeleteUser(c *gin.Context) {
+	id, ok := accessibleUserID(c)
+	if !ok {
+		return
+	}
+	if err := uc.userService.DeleteUser(id); err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (uc *UserController) RestoreUser(c *gin.Context) {
+	id, ok := userID(c)
+	if !ok {
+		return
+	}
+	user, err := uc.userService.RestoreUser(id)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// PurgeUser permanently deletes a user; routed behind admin-only permissions
+func (uc *UserController) PurgeUser(c *gin.Context) {
+	id, ok := userID(c)
+	if !ok {
+		return
+	}
+	if err := uc.userService.PurgeUser(id); err != nil {
+		respondUserError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// userID parses the :id path parameter, responding with 400 when it is invalid
+func userID(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// accessibleUserID parses the :id path parameter and checks that the current user may
+// access that user. Other users' accounts are reported as not found.
+func accessibleUserID(c *gin.Context) (uint, bool) {
+	id, ok := userID(c)
+	if !ok {
+		return 0, false
+	}
+	if currentUser, _ := middleware.CurrentUser(c); !services.CanAccess(currentUser, id) {
+		c.JSON(http.StatusNotFound, gin.H{"error": services.ErrUserNotFound.Error()})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondUserError maps user service errors to HTTP status codes
+func respondUserError(c *gin.Context, err error) {
+	var conflict *services.ConflictError
+	switch {
+	case errors.As(err, &conflict):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "conflict", "field": conflict.Field})
+	case errors.Is(err, services.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUserNotDeleted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnknownModel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process user request"})
+	}
+}
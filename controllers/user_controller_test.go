@@ -0,0 +1,72 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondUserError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   string
+		wantField  string
+	}{
+		{
+			name:       "email conflict",
+			err:        &services.ConflictError{Field: "email", Err: services.ErrEmailTaken},
+			wantStatus: http.StatusConflict,
+			wantCode:   "conflict",
+			wantField:  "email",
+		},
+		{
+			name:       "wrapped conflict",
+			err:        fmt.Errorf("import row 3: %w", &services.ConflictError{Field: "email", Err: services.ErrEmailTaken}),
+			wantStatus: http.StatusConflict,
+			wantCode:   "conflict",
+			wantField:  "email",
+		},
+		{name: "not found", err: services.ErrUserNotFound, wantStatus: http.StatusNotFound},
+		{name: "not deleted", err: services.ErrUserNotDeleted, wantStatus: http.StatusConflict},
+		{name: "unknown model", err: services.ErrUnknownModel, wantStatus: http.StatusBadRequest},
+		{name: "database failure", err: errors.New("disk I/O error"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			respondUserError(c, tt.err)
+
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			var got struct {
+				Error string `json:"error"`
+				Code  string `json:"code"`
+				Field string `json:"field"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response is not JSON: %s", w.Body)
+			}
+			if got.Code != tt.wantCode || got.Field != tt.wantField {
+				t.Errorf("code, field = %q, %q, want %q, %q", got.Code, got.Field, tt.wantCode, tt.wantField)
+			}
+			// Unexpected errors are not shown to clients
+			if tt.wantStatus == http.StatusInternalServerError && got.Error == tt.err.Error() {
+				t.Errorf("error %q leaked to the client", got.Error)
+			}
+		})
+	}
+}
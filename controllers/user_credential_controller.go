@@ -0,0 +1,71 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"sample-api/middleware"
+	"sample-api/models"
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UserCredentialController struct {
+	credentialService *services.UserCredentialService
+}
+
+func NewUserCredentialController(credentialService *services.UserCredentialService) *UserCredentialController {
+	return &UserCredentialController{
+		credentialService: credentialService,
+	}
+}
+
+func (uc *UserCredentialController) ListCredentials(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	credentials, err := uc.credentialService.List(user.ID)
+	if err != nil {
+		respondCredentialError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, credentials)
+}
+
+// SetCredential stores the user's own key for a provider; their AI requests then use it
+// instead of the organization's or the server's
+func (uc *UserCredentialController) SetCredential(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	var req models.SetCredentialRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+	credential, err := uc.credentialService.Set(user.ID, c.Param("provider"), req)
+	if err != nil {
+		respondCredentialError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, credential)
+}
+
+func (uc *UserCredentialController) DeleteCredential(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	if err := uc.credentialService.Delete(user.ID, c.Param("provider")); err != nil {
+		respondCredentialError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// respondCredentialError maps user credential errors to HTTP status codes
+func respondCredentialError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrUnknownProvider), errors.Is(err, services.ErrUnknownModel):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrCredentialNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrEncryptionDisabled):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process credential request"})
+	}
+}
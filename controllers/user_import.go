@@ -0,0 +1,289 @@
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"sample-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const (
+	importFormatCSV   = "csv"
+	importFormatJSONL = "jsonl"
+
+	maxImportBytes = 10 << 20
+	maxImportRows  = 10000
+)
+
+var (
+	errTooManyImportRows = fmt.Errorf("import files are limited to %d rows", maxImportRows)
+
+	userExportColumns = []string{"id", "name", "email", "role", "email_verified_at", "created_at"}
+)
+
+// ImportUsers creates users from a CSV (with a header row) or JSON Lines body. Query
+// parameters: format (csv or jsonl, otherwise taken from Content-Type), mode (atomic,
+// the default, or best_effort) and dry_run.
+func (uc *UserController) ImportUsers(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = formatFromContentType(c.ContentType())
+	}
+	if format != importFormatCSV && format != importFormatJSONL {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Import body must be CSV (text/csv) or JSON Lines (application/x-ndjson)"})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", models.ImportModeAtomic)
+	if mode != models.ImportModeAtomic && mode != models.ImportModeBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode must be atomic or best_effort"})
+		return
+	}
+	dryRun, err := strconv.ParseBool(c.DefaultQuery("dry_run", "false"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportBytes)
+	var rows []models.UserImportRow
+	if format == importFormatCSV {
+		rows, err = parseUserCSV(body)
+	} else {
+		rows, err = parseUserJSONL(body)
+	}
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) || errors.Is(err, errTooManyImportRows) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if len(rows) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Import file has no rows"})
+		return
+	}
+
+	response, err := uc.userService.ImportUsers(rows, mode, dryRun)
+	if err != nil {
+		respondUserError(c, err)
+		return
+	}
+
+	status := http.StatusOK
+	if !response.Committed && !response.DryRun {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, response)
+}
+
+// ExportUsers streams every user as CSV (default) or JSON Lines, selected with ?format=
+func (uc *UserController) ExportUsers(c *gin.Context) {
+	format := c.DefaultQuery("format", importFormatCSV)
+
+	var writeBatch func([]models.User) error
+	switch format {
+	case importFormatCSV:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		w := csv.NewWriter(c.Writer)
+		if err := w.Write(userExportColumns); err != nil {
+			return
+		}
+		writeBatch = func(users []models.User) error {
+			for _, user := range users {
+				verifiedAt := ""
+				if user.EmailVerifiedAt != nil {
+					verifiedAt = user.EmailVerifiedAt.UTC().Format(time.RFC3339)
+				}
+				if err := w.Write([]string{
+					strconv.FormatUint(uint64(user.ID), 10), escapeCSVCell(user.Name), escapeCSVCell(user.Email), escapeCSVCell(user.Role),
+					verifiedAt, user.CreatedAt.UTC().Format(time.RFC3339),
+				}); err != nil {
+					return err
+				}
+			}
+			w.Flush()
+			return w.Error()
+		}
+	case importFormatJSONL:
+		c.Header("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(c.Writer)
+		writeBatch = func(users []models.User) error {
+			for _, user := range users {
+				if err := enc.Encode(user); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or jsonl"})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="users.%s"`, format))
+	c.Status(http.StatusOK)
+
+	err := uc.userService.ExportUsers(func(users []models.User) error {
+		if err := writeBatch(users); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		// Headers are already sent, so the client only sees a truncated file
+		slog.ErrorContext(c.Request.Context(), "User export failed", "error", err)
+		c.Abort()
+	}
+}
+
+func formatFromContentType(contentType string) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "text/csv", "application/csv":
+		return importFormatCSV
+	case "application/x-ndjson", "application/jsonl", "application/x-jsonlines", "application/jsonlines":
+		return importFormatJSONL
+	}
+	return ""
+}
+
+// parseUserCSV reads rows with name, email and optional role columns in any order.
+// Other columns, such as those in an export, are ignored.
+func parseUserCSV(r io.Reader) ([]models.UserImportRow, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, required := range []string{"name", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header must include a %q column", required)
+		}
+	}
+
+	column := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return unescapeCSVCell(record[i])
+		}
+		return ""
+	}
+
+	var rows []models.UserImportRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) == maxImportRows {
+			return nil, errTooManyImportRows
+		}
+
+		line, _ := reader.FieldPos(0)
+		row := models.UserImportRow{
+			Line: line,
+			User: models.CreateUserRequest{
+				Name:  column(record, "name"),
+				Email: column(record, "email"),
+				Role:  column(record, "role"),
+			},
+		}
+		row.Errors = validateImportRow(&row.User)
+		rows = append(rows, row)
+	}
+}
+
+// escapeCSVCell keeps spreadsheets from running a cell as a formula by prefixing values
+// that start like one with a quote
+func escapeCSVCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// unescapeCSVCell undoes escapeCSVCell so exported files can be imported again
+func unescapeCSVCell(value string) string {
+	if len(value) > 1 && value[0] == '\'' && escapeCSVCell(value[1:]) != value[1:] {
+		return value[1:]
+	}
+	return value
+}
+
+// parseUserJSONL reads one JSON object per line; blank lines are skipped
+func parseUserJSONL(r io.Reader) ([]models.UserImportRow, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1<<20)
+
+	var rows []models.UserImportRow
+	for line := 1; scanner.Scan(); line++ {
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		if len(rows) == maxImportRows {
+			return nil, errTooManyImportRows
+		}
+
+		row := models.UserImportRow{Line: line}
+		if err := json.Unmarshal(text, &row.User); err != nil {
+			row.Errors = validationFieldErrors(err)
+			if row.Errors == nil {
+				row.Errors = []models.FieldError{{Code: "invalid_json", Message: "line is not a valid JSON object"}}
+			}
+		} else {
+			row.Errors = validateImportRow(&row.User)
+		}
+		rows = append(rows, row)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read JSON Lines: %w", err)
+	}
+	return rows, nil
+}
+
+// validateImportRow applies the same normalization and rules as POST /users
+func validateImportRow(req *models.CreateUserRequest) []models.FieldError {
+	req.Normalize()
+	if err := binding.Validator.ValidateStruct(req); err != nil {
+		if fields := validationFieldErrors(err); fields != nil {
+			return fields
+		}
+		return []models.FieldError{{Code: "invalid", Message: err.Error()}}
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sample-api/models"
+)
+
+func TestParseUserCSV(t *testing.T) {
+	input := "\ufeffRole, Email ,name,id\n" +
+		"admin,Ada@Example.com,Ada Lovelace,1\n" +
+		"\n" +
+		",grace@example.com,'=SUM(A1),2\n" +
+		"owner,not an email,,3\n" +
+		"member,short@example.com\n"
+
+	rows, err := parseUserCSV(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseUserCSV: %v", err)
+	}
+
+	want := []models.UserImportRow{
+		{Line: 2, User: models.CreateUserRequest{Name: "Ada Lovelace", Email: "ada@example.com", Role: "admin"}},
+		{Line: 4, User: models.CreateUserRequest{Name: "=SUM(A1)", Email: "grace@example.com"}},
+		{Line: 5, User: models.CreateUserRequest{Email: "not an email", Role: "owner"}, Errors: []models.FieldError{
+			{Field: "name", Code: "required", Message: "is required"},
+			{Field: "email", Code: "invalid_email", Message: "must be a valid email address"},
+			{Field: "role", Code: "invalid_choice", Message: "must be one of: admin, member, viewer"},
+		}},
+		{Line: 6, User: models.CreateUserRequest{Email: "short@example.com", Role: "member"}, Errors: []models.FieldError{
+			{Field: "name", Code: "required", Message: "is required"},
+		}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v\nwant %+v", rows, want)
+	}
+}
+
+func TestParseUserCSVErrors(t *testing.T) {
+	tooMany := "name,email\n" + strings.Repeat("a,a@example.com\n", maxImportRows+1)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{name: "missing email column", input: "name,role\nAda,admin\n", wantErr: `"email" column`},
+		{name: "unterminated quote", input: "name,email\n\"Ada,ada@example.com\n", wantErr: "invalid CSV"},
+		{name: "too many rows", input: tooMany, wantErr: errTooManyImportRows.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseUserCSV(strings.NewReader(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("parseUserCSV error = %v, want one mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	rows, err := parseUserCSV(strings.NewReader(""))
+	if err != nil || len(rows) != 0 {
+		t.Errorf("empty file = %v, %v, want no rows", rows, err)
+	}
+}
+
+func TestParseUserJSONL(t *testing.T) {
+	input := `{"name": "Ada", "email": "ADA@example.com", "role": "admin"}` + "\n" +
+		"\n" +
+		`{"name": "Grace", "email": 7}` + "\n" +
+		`not json` + "\n" +
+		`{"name": "  ", "email": "grace@example.com"}` + "\n"
+
+	rows, err := parseUserJSONL(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseUserJSONL: %v", err)
+	}
+
+	want := []models.UserImportRow{
+		{Line: 1, User: models.CreateUserRequest{Name: "Ada", Email: "ada@example.com", Role: "admin"}},
+		{Line: 3, User: models.CreateUserRequest{Name: "Grace"}, Errors: []models.FieldError{
+			{Field: "email", Code: "invalid_type", Message: "must be a string"},
+		}},
+		{Line: 4, Errors: []models.FieldError{
+			{Code: "invalid_json", Message: "line is not a valid JSON object"},
+		}},
+		{Line: 5, User: models.CreateUserRequest{Email: "grace@example.com"}, Errors: []models.FieldError{
+			{Field: "name", Code: "required", Message: "is required"},
+		}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v\nwant %+v", rows, want)
+	}
+
+	tooMany := strings.Repeat(`{"name": "a", "email": "a@example.com"}`+"\n", maxImportRows+1)
+	if _, err := parseUserJSONL(strings.NewReader(tooMany)); !errors.Is(err, errTooManyImportRows) {
+		t.Errorf("parseUserJSONL error = %v, want %v", err, errTooManyImportRows)
+	}
+}
+
+func TestEscapeCSVCell(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{value: "Ada Lovelace", want: "Ada Lovelace"},
+		{value: "", want: ""},
+		{value: "=1+1", want: "'=1+1"},
+		{value: "+1", want: "'+1"},
+		{value: "-1", want: "'-1"},
+		{value: "@SUM(A1)", want: "'@SUM(A1)"},
+		{value: "\tcmd", want: "'\tcmd"},
+		{value: "\rcmd", want: "'\rcmd"},
+		// A quote that does not protect a formula is kept as typed
+		{value: "'quoted", want: "'quoted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%q", tt.value), func(t *testing.T) {
+			if got := escapeCSVCell(tt.value); got != tt.want {
+				t.Errorf("escapeCSVCell = %q, want %q", got, tt.want)
+			}
+			if got := unescapeCSVCell(escapeCSVCell(tt.value)); got != tt.value {
+				t.Errorf("round trip = %q, want %q", got, tt.value)
+			}
+		})
+	}
+}
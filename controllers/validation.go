@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"sample-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/go-playground/validator/v10/non-standard/validators"
+)
+
+// normalizer is implemented by requests that clean up their input (trimming, lowercasing)
+// before it is validated
+type normalizer interface {
+	Normalize()
+}
+
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterValidation("notblank", validators.NotBlank)
+
+		// Report fields by their JSON (or query) names rather than Go field names
+		v.RegisterTagNameFunc(func(field reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return field.Name
+		})
+	}
+}
+
+// bindJSON decodes a JSON body into obj, normalizes it and validates it. On failure it
+// responds with 400 and the rejected fields, and returns false.
+func bindJSON(c *gin.Context, obj any) bool {
+	if c.Request.Body == nil {
+		respondBindError(c, io.EOF)
+		return false
+	}
+	if err := json.NewDecoder(c.Request.Body).Decode(obj); err != nil {
+		respondBindError(c, err)
+		return false
+	}
+	if n, ok := obj.(normalizer); ok {
+		n.Normalize()
+	}
+	if err := binding.Validator.ValidateStruct(obj); err != nil {
+		respondBindError(c, err)
+		return false
+	}
+	return true
+}
+
+// respondBindError turns a decoding or validation error into a 400 response
+func respondBindError(c *gin.Context, err error) {
+	if fields := validationFieldErrors(err); fields != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "Validation failed",
+			"code":   "validation_failed",
+			"fields": fields,
+		})
+		return
+	}
+
+	switch {
+	case errors.Is(err, io.EOF):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request body is empty", "code": "invalid_json"})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Malformed JSON: " + err.Error(), "code": "invalid_json"})
+	}
+}
+
+// validationFieldErrors converts validation and JSON type errors into field errors. It
+// returns nil for any other error.
+func validationFieldErrors(err error) []models.FieldError {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		fields := make([]models.FieldError, 0, len(validationErrors))
+		for _, fe := range validationErrors {
+			fields = append(fields, fieldError(fe))
+		}
+		return fields
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return []models.FieldError{{
+			Field:   typeError.Field,
+			Code:    "invalid_type",
+			Message: "must be a " + jsonTypeName(typeError.Type),
+		}}
+	}
+	return nil
+}
+
+func fieldError(fe validator.FieldError) models.FieldError {
+	// Drop the struct name so nested fields read like "chunk.mode" or "scopes[0]"
+	field := fe.Field()
+	if _, rest, ok := strings.Cut(fe.Namespace(), "."); ok {
+		field = rest
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return models.FieldError{Field: field, Code: "required", Message: "is required"}
+	case "notblank":
+		return models.FieldError{Field: field, Code: "blank", Message: "must not be blank"}
+	case "email":
+		return models.FieldError{Field: field, Code: "invalid_email", Message: "must be a valid email address"}
+	case "max":
+		if fe.Kind() == reflect.String {
+			return models.FieldError{Field: field, Code: "too_long", Message: "must be at most " + fe.Param() + " characters"}
+		}
+		return models.FieldError{Field: field, Code: "too_long", Message: "must have at most " + fe.Param() + " items"}
+	case "min":
+		if fe.Kind() == reflect.String {
+			return models.FieldError{Field: field, Code: "too_short", Message: "must be at least " + fe.Param() + " characters"}
+		}
+		return models.FieldError{Field: field, Code: "too_short", Message: "must have at least " + fe.Param() + " items"}
+	case "oneof":
+		return models.FieldError{Field: field, Code: "invalid_choice", Message: "must be one of: " + strings.ReplaceAll(fe.Param(), " ", ", ")}
+	default:
+		return models.FieldError{Field: field, Code: "invalid", Message: "is invalid"}
+	}
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "number"
+	}
+}
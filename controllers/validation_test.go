@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"sample-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bindResponse is the body bindJSON responds with when it rejects a request
+type bindResponse struct {
+	Error  string              `json:"error"`
+	Code   string              `json:"code"`
+	Fields []models.FieldError `json:"fields"`
+}
+
+func TestBindJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		body string
+		// obj returns the request the body is bound to
+		obj func() any
+		// want is the bound request when binding succeeds
+		want       any
+		wantCode   string
+		wantFields []models.FieldError
+	}{
+		{
+			name: "valid request is normalized",
+			body: `{"name": "  Ada  Lovelace ", "email": " Ada@Example.COM ", "password": "correct horse"}`,
+			obj:  func() any { return &models.RegisterRequest{} },
+			want: &models.RegisterRequest{Name: "Ada Lovelace", Email: "ada@example.com", Password: "correct horse"},
+		},
+		{
+			name:     "empty body",
+			obj:      func() any { return &models.RegisterRequest{} },
+			wantCode: "invalid_json",
+		},
+		{
+			name:     "malformed JSON",
+			body:     `{"name": "Ada",`,
+			obj:      func() any { return &models.RegisterRequest{} },
+			wantCode: "invalid_json",
+		},
+		{
+			name:     "missing and invalid fields",
+			body:     `{"email": "not an email", "password": "short"}`,
+			obj:      func() any { return &models.RegisterRequest{} },
+			wantCode: "validation_failed",
+			wantFields: []models.FieldError{
+				{Field: "name", Code: "required", Message: "is required"},
+				{Field: "email", Code: "invalid_email", Message: "must be a valid email address"},
+				{Field: "password", Code: "too_short", Message: "must be at least 8 characters"},
+			},
+		},
+		{
+			name:     "too long",
+			body:     `{"name": "` + strings.Repeat("a", 101) + `", "email": "ada@example.com", "password": "correct horse"}`,
+			obj:      func() any { return &models.RegisterRequest{} },
+			wantCode: "validation_failed",
+			wantFields: []models.FieldError{
+				{Field: "name", Code: "too_long", Message: "must be at most 100 characters"},
+			},
+		},
+		{
+			name:     "wrong JSON type",
+			body:     `{"name": 42, "email": "ada@example.com", "password": "correct horse"}`,
+			obj:      func() any { return &models.RegisterRequest{} },
+			wantCode: "validation_failed",
+			wantFields: []models.FieldError{
+				{Field: "name", Code: "invalid_type", Message: "must be a string"},
+			},
+		},
+		{
+			name:     "blank optional field",
+			body:     `{"name": "   "}`,
+			obj:      func() any { return &models.UpdateUserRequest{} },
+			wantCode: "validation_failed",
+			wantFields: []models.FieldError{
+				{Field: "name", Code: "blank", Message: "must not be blank"},
+			},
+		},
+		{
+			name:     "invalid list item",
+			body:     `{"label": "ci", "scopes": ["ai", "admin"]}`,
+			obj:      func() any { return &models.CreateAPIKeyRequest{} },
+			wantCode: "validation_failed",
+			wantFields: []models.FieldError{
+				{Field: "scopes[1]", Code: "invalid_choice", Message: "must be one of: ai, audio, orgs:read, users:read, users:write"},
+			},
+		},
+		{
+			name:     "empty list",
+			body:     `{"label": "ci", "scopes": []}`,
+			obj:      func() any { return &models.CreateAPIKeyRequest{} },
+			wantCode: "validation_failed",
+			wantFields: []models.FieldError{
+				{Field: "scopes", Code: "too_short", Message: "must have at least 1 items"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+
+			obj := tt.obj()
+			ok := bindJSON(c, obj)
+			if ok != (tt.wantCode == "") {
+				t.Fatalf("bindJSON = %v, response %d %s", ok, w.Code, w.Body)
+			}
+			if ok {
+				if !reflect.DeepEqual(obj, tt.want) {
+					t.Errorf("bound %+v, want %+v", obj, tt.want)
+				}
+				return
+			}
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			var got bindResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				t.Fatalf("response is not JSON: %s", w.Body)
+			}
+			if got.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", got.Code, tt.wantCode)
+			}
+			if !reflect.DeepEqual(got.Fields, tt.wantFields) {
+				t.Errorf("fields = %+v, want %+v", got.Fields, tt.wantFields)
+			}
+		})
+	}
+}
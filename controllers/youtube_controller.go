@@ -1,7 +1,12 @@
 package controllers
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sample-api/middleware"
 	"sample-api/models"
 	"sample-api/services"
 
@@ -10,15 +15,24 @@ import (
 
 type YouTubeController struct {
 	youtubeService *services.YouTubeService
+	audioService   *services.AudioService
+	mediaService   *services.MediaService
+	orgService     *services.OrganizationService
 }
 
-func NewYouTubeController(youtubeService *services.YouTubeService) *YouTubeController {
+func NewYouTubeController(youtubeService *services.YouTubeService, audioService *services.AudioService, mediaService *services.MediaService, orgService *services.OrganizationService) *YouTubeController {
 	return &YouTubeController{
 		youtubeService: youtubeService,
+		audioService:   audioService,
+		mediaService:   mediaService,
+		orgService:     orgService,
 	}
 }
 
 func (yc *YouTubeController) ExtractAudio(c *gin.Context) {
+	user, _ := middleware.CurrentUser(c)
+	org, _, _ := middleware.CurrentOrganization(c)
+
 	var req models.ExtractAudioRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, models.ExtractAudioResponse{
@@ -28,7 +42,15 @@ func (yc *YouTubeController) ExtractAudio(c *gin.Context) {
 		return
 	}
 
-	filePath, err := yc.youtubeService.ExtractAudio(req.URL)
+	filePath, err := yc.youtubeService.ExtractAudio(c.Request.Context(), req.URL)
+	if errors.Is(err, services.ErrShuttingDown) {
+		c.Header("Retry-After", "30")
+		c.JSON(http.StatusServiceUnavailable, models.ExtractAudioResponse{
+			Success: false,
+			Message: err.Error(),
+		})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, models.ExtractAudioResponse{
 			Success: false,
@@ -37,12 +59,69 @@ func (yc *YouTubeController) ExtractAudio(c *gin.Context) {
 		return
 	}
 
-	// Return file download
-	if err := yc.youtubeService.ServeAudioFile(c, filePath); err != nil {
+	// Optional ffmpeg post-processing
+	processed := &services.ProcessedAudio{Path: filePath}
+	if req.Normalize || req.TrimSilence || req.Chunk != nil {
+		processed, err = yc.audioService.Process(filePath, req.AudioProcessingOptions)
+		if err != nil {
+			os.Remove(filePath)
+			c.JSON(http.StatusInternalServerError, models.ExtractAudioResponse{
+				Success: false,
+				Message: "Failed to process audio: " + err.Error(),
+			})
+			return
+		}
+	}
+
+	// Register the files so they can be fetched later through signed links. If any of
+	// them fails, none are returned, so everything produced is removed again.
+	var registered []models.MediaFile
+	fail := func(message string, err error) {
+		if err := yc.mediaService.Discard(registered...); err != nil {
+			slog.ErrorContext(c.Request.Context(), "Failed to discard registered files", "error", err)
+		}
+		os.Remove(processed.Path)
+		for _, segment := range processed.Chunks {
+			os.Remove(segment.Path)
+		}
 		c.JSON(http.StatusInternalServerError, models.ExtractAudioResponse{
 			Success: false,
-			Message: "Failed to serve file: " + err.Error(),
+			Message: message + err.Error(),
 		})
+	}
+
+	file, err := yc.mediaService.Register(processed.Path, filepath.Base(processed.Path), "audio/mpeg", user.ID, org.ID)
+	if err != nil {
+		fail("Failed to store file: ", err)
 		return
 	}
+	registered = append(registered, file)
+
+	var chunks []models.AudioChunk
+	for _, segment := range processed.Chunks {
+		chunkFile, err := yc.mediaService.Register(segment.Path, filepath.Base(segment.Path), "audio/mpeg", user.ID, org.ID)
+		if err != nil {
+			fail("Failed to store chunk: ", err)
+			return
+		}
+		registered = append(registered, chunkFile)
+		chunks = append(chunks, models.AudioChunk{
+			FileID:   chunkFile.ID,
+			FileURL:  yc.mediaService.SignedURL(baseURL(c), chunkFile),
+			Start:    segment.Start,
+			Duration: segment.Duration,
+		})
+	}
+
+	recordUsage(c, yc.orgService, models.UsageKindExtractAudio, "")
+
+	c.JSON(http.StatusOK, models.ExtractAudioResponse{
+		Success:   true,
+		Message:   "Audio extracted successfully",
+		FileID:    file.ID,
+		FileURL:   yc.mediaService.SignedURL(baseURL(c), file),
+		ExpiresAt: &file.ExpiresAt,
+		Duration:  processed.Duration,
+		Chunks:    chunks,
+	})
 }
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"sample-api/config"
+)
+
+// sdListenFDsStart is the first file descriptor systemd passes with socket activation
+const sdListenFDsStart = 3
+
+// listenAddress describes where the server accepts connections
+type listenAddress struct {
+	Network string `json:"network"`
+	Address string `json:"address"`
+	Port    int    `json:"port,omitempty"`
+	PID     int    `json:"pid"`
+}
+
+// listen opens the listener the server accepts connections on: a socket passed by
+// systemd, else the configured Unix domain socket, else the configured host and port.
+// A port in use is an error unless fallback to a random port is enabled.
+func listen(cfg config.ServerConfig) (net.Listener, error) {
+	if listener, err := systemdListener(); listener != nil || err != nil {
+		return listener, err
+	}
+	if cfg.UnixSocket != "" {
+		return listenUnix(cfg.UnixSocket)
+	}
+
+	address := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+	listener, err := net.Listen("tcp", address)
+	if err != nil && cfg.PortFallback && cfg.Port != 0 {
+		slog.Warn("Port is not available, falling back to a random port", "address", address, "error", err)
+		listener, err = net.Listen("tcp", net.JoinHostPort(cfg.Host, "0"))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", address, err)
+	}
+	return listener, nil
+}
+
+// systemdListener returns the first socket passed by systemd socket activation, or nil
+// when the process was not socket activated
+func systemdListener() (net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q from systemd", os.Getenv("LISTEN_FDS"))
+	}
+	// The sockets are meant for this process only, not for yt-dlp or ffmpeg
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if n > 1 {
+		slog.Warn("systemd passed several sockets, only the first is used", "count", n)
+	}
+
+	file := os.NewFile(sdListenFDsStart, "systemd-socket")
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use socket passed by systemd: %w", err)
+	}
+	return listener, nil
+}
+
+// listenUnix listens on a Unix domain socket, replacing a stale socket left behind by
+// a previous run but never a live one or another kind of file
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("failed to listen on %s: file exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to listen on %s: socket is in use", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	return listener, nil
+}
+
+// describe returns the actual address of a listener
+func describe(listener net.Listener) listenAddress {
+	addr := listenAddress{
+		Network: listener.Addr().Network(),
+		Address: listener.Addr().String(),
+		PID:     os.Getpid(),
+	}
+	if tcp, ok := listener.Addr().(*net.TCPAddr); ok {
+		addr.Port = tcp.Port
+	}
+	return addr
+}
+
+// announce writes the address as one JSON line to path, or to stdout when path is "-".
+// The file is replaced atomically so readers never see a partial address.
+func announce(addr listenAddress, path string) error {
+	data, err := json.Marshal(addr)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".address-*")
+	if err != nil {
+		return fmt.Errorf("failed to write address file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write address file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write address file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write address file: %w", err)
+	}
+	return nil
+}
+
+// removeAnnouncement deletes the address file when the server stops
+func removeAnnouncement(path string) {
+	if path == "" || path == "-" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		slog.Error("Failed to remove address file", "error", err)
+	}
+}
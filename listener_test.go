@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"sample-api/config"
+)
+
+// socketDir returns a short temporary directory; Unix socket paths are limited to
+// about a hundred bytes, which t.TempDir can exceed
+func socketDir(t *testing.T) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestListenTCP(t *testing.T) {
+	busy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busy.Close()
+	busyPort := busy.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name    string
+		cfg     config.ServerConfig
+		wantErr string
+	}{
+		{name: "random port", cfg: config.ServerConfig{Host: "127.0.0.1"}},
+		{name: "port in use", cfg: config.ServerConfig{Host: "127.0.0.1", Port: busyPort}, wantErr: "failed to listen on 127.0.0.1:"},
+		{name: "port in use with fallback", cfg: config.ServerConfig{Host: "127.0.0.1", Port: busyPort, PortFallback: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, err := listen(tt.cfg)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("listen error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("listen: %v", err)
+			}
+			defer listener.Close()
+
+			addr := describe(listener)
+			if addr.Network != "tcp" || addr.Port == 0 || addr.Port == busyPort || addr.PID != os.Getpid() {
+				t.Errorf("describe = %+v, want a free TCP port of this process", addr)
+			}
+			if !strings.HasPrefix(addr.Address, "127.0.0.1:") {
+				t.Errorf("address = %q, want one on 127.0.0.1", addr.Address)
+			}
+		})
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	dir := socketDir(t)
+	path := filepath.Join(dir, "api.sock")
+
+	listener, err := listen(config.ServerConfig{UnixSocket: path})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	if addr := describe(listener); addr.Network != "unix" || addr.Address != path || addr.Port != 0 {
+		t.Errorf("describe = %+v, want the socket path", addr)
+	}
+
+	// A live socket is never taken over
+	if _, err := listen(config.ServerConfig{UnixSocket: path}); err == nil || !strings.Contains(err.Error(), "socket is in use") {
+		t.Errorf("listen on a live socket: error = %v, want it in use", err)
+	}
+
+	// A socket left behind by a previous run is replaced
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	listener.Close()
+	listener, err = listen(config.ServerConfig{UnixSocket: path})
+	if err != nil {
+		t.Fatalf("listen on a stale socket: %v", err)
+	}
+	listener.Close()
+
+	// Other files are never removed
+	file := filepath.Join(dir, "data.db")
+	if err := os.WriteFile(file, []byte("data"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listen(config.ServerConfig{UnixSocket: file}); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Errorf("listen on a regular file: error = %v, want not a socket", err)
+	}
+	if data, err := os.ReadFile(file); err != nil || string(data) != "data" {
+		t.Errorf("regular file = %q, %v, want it untouched", data, err)
+	}
+}
+
+func TestAnnounce(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "address.json")
+	if err := os.WriteFile(path, []byte("stale"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	addr := listenAddress{Network: "tcp", Address: "127.0.0.1:8080", Port: 8080, PID: 42}
+	if err := announce(addr, path); err != nil {
+		t.Fatalf("announce: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(data), "}\n") || strings.Count(string(data), "\n") != 1 {
+		t.Errorf("address file = %q, want one JSON line", data)
+	}
+	var got listenAddress
+	if err := json.Unmarshal(data, &got); err != nil || got != addr {
+		t.Errorf("address file = %+v, %v, want %+v", got, err, addr)
+	}
+
+	// No temporary files are left next to the address file
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d files, want only the address file", len(entries))
+	}
+
+	removeAnnouncement(path)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("address file still exists: %v", err)
+	}
+	// Removing it again, or the stdout announcement, is harmless
+	removeAnnouncement(path)
+	removeAnnouncement("-")
+	removeAnnouncement("")
+
+	if err := announce(addr, filepath.Join(dir, "missing", "address.json")); err == nil {
+		t.Error("announce into a missing directory succeeded")
+	}
+}
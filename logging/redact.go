@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const redacted = "[redacted]"
+
+// minSecretLength keeps short values such as "test" from being redacted everywhere
+const minSecretLength = 8
+
+// sensitiveKeys are attribute names whose values are never logged
+var sensitiveKeys = map[string]bool{
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+	"api_key":       true,
+	"apikey":        true,
+	"authorization": true,
+	"client_secret": true,
+}
+
+// credentialPatterns match credentials by their shape, including keys users bring
+// themselves that the configuration does not know about
+var credentialPatterns = []struct {
+	re          *regexp.Regexp
+	replacement string
+}{
+	// Query parameters carrying keys, e.g. Google's ?key=
+	{regexp.MustCompile(`(?i)([?&](?:key|api_key|apikey|access_token|client_secret|password)=)[^&\s"']+`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + redacted},
+	// OpenAI and Anthropic keys
+	{regexp.MustCompile(`\bsk-[A-Za-z0-9_-]{16,}`), redacted},
+	// Google API keys
+	{regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{30,}`), redacted},
+}
+
+// Redactor removes secrets from log attributes. Secrets can be added while logging,
+// e.g. when keys are reloaded.
+type Redactor struct {
+	mu      sync.Mutex
+	known   map[string]bool
+	secrets atomic.Pointer[strings.Replacer]
+}
+
+// NewRedactor creates a redactor for the given secrets in addition to the usual shapes
+// of credentials
+func NewRedactor(secrets []string) *Redactor {
+	r := &Redactor{known: make(map[string]bool)}
+	r.Add(secrets)
+	return r
+}
+
+// Add redacts secrets from now on. Secrets added earlier stay redacted: a key that was
+// rotated out may still turn up, e.g. in errors of requests that were using it.
+func (r *Redactor) Add(secrets []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, secret := range secrets {
+		if len(secret) >= minSecretLength {
+			r.known[secret] = true
+		}
+	}
+	pairs := make([]string, 0, 2*len(r.known))
+	for secret := range r.known {
+		pairs = append(pairs, secret, redacted)
+	}
+	r.secrets.Store(strings.NewReplacer(pairs...))
+}
+
+func (r *Redactor) redact(s string) string {
+	s = r.secrets.Load().Replace(s)
+	for _, p := range credentialPatterns {
+		s = p.re.ReplaceAllString(s, p.replacement)
+	}
+	return s
+}
+
+// replaceAttr is a slog.HandlerOptions.ReplaceAttr that redacts the message and
+// attributes, including error messages and other values logged as they are
+func (r *Redactor) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if sensitiveKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, r.redact(a.Value.String()))
+	case slog.KindAny:
+		value := a.Value.Any()
+		if err, ok := value.(error); ok {
+			return slog.String(a.Key, r.redact(err.Error()))
+		}
+		// Structs, maps and slices are only flattened to text when they contain a secret
+		text := fmt.Sprintf("%+v", value)
+		if redactedText := r.redact(text); redactedText != text {
+			return slog.String(a.Key, redactedText)
+		}
+	}
+	return a
+}
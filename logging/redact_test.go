@@ -0,0 +1,168 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"sample-api/config"
+)
+
+type credentials struct {
+	User string
+	Key  string
+}
+
+func TestRedactor(t *testing.T) {
+	openAIKey := "sk-proj-" + strings.Repeat("a1", 12)
+	googleKey := "AIza" + strings.Repeat("b2", 16)
+
+	tests := []struct {
+		name string
+		log  func(logger *slog.Logger)
+		// secret must not appear in the output and kept must
+		secret string
+		kept   string
+	}{
+		{
+			name:   "configured secret in the message",
+			log:    func(l *slog.Logger) { l.Info("using configured-secret-value now") },
+			secret: "configured-secret-value",
+			kept:   "using [redacted] now",
+		},
+		{
+			name:   "sensitive key",
+			log:    func(l *slog.Logger) { l.Info("login", "Password", "hunter2") },
+			secret: "hunter2",
+			kept:   `"Password":"[redacted]"`,
+		},
+		{
+			name:   "sensitive key with a non-string value",
+			log:    func(l *slog.Logger) { l.Info("login", "token", 123456789) },
+			secret: "123456789",
+			kept:   `"token":"[redacted]"`,
+		},
+		{
+			name: "key in a URL",
+			log: func(l *slog.Logger) {
+				l.Info("request", "url", "https://api.example.com/v1?alt=json&key=abc123def&x=1")
+			},
+			secret: "abc123def",
+			kept:   "key=[redacted]&x=1",
+		},
+		{
+			name:   "bearer token",
+			log:    func(l *slog.Logger) { l.Info("request", "header", "Bearer eyJhbGciOi.payload.sig") },
+			secret: "eyJhbGciOi",
+			kept:   "Bearer [redacted]",
+		},
+		{
+			name:   "unknown OpenAI key",
+			log:    func(l *slog.Logger) { l.Info("provider said", "body", "invalid key "+openAIKey) },
+			secret: openAIKey,
+			kept:   "invalid key [redacted]",
+		},
+		{
+			name:   "unknown Google key",
+			log:    func(l *slog.Logger) { l.Info("provider said", "body", googleKey+" is invalid") },
+			secret: googleKey,
+			kept:   "[redacted] is invalid",
+		},
+		{
+			name: "error",
+			log: func(l *slog.Logger) {
+				l.Error("call failed", "error", fmt.Errorf("wrapped: %w", errors.New("bad configured-secret-value")))
+			},
+			secret: "configured-secret-value",
+			kept:   "wrapped: bad [redacted]",
+		},
+		{
+			name: "struct containing a secret",
+			log: func(l *slog.Logger) {
+				l.Info("loaded", "credentials", credentials{User: "ada", Key: "configured-secret-value"})
+			},
+			secret: "configured-secret-value",
+			kept:   "User:ada",
+		},
+		{
+			name: "struct without secrets is logged as it is",
+			log:  func(l *slog.Logger) { l.Info("loaded", "credentials", credentials{User: "ada", Key: "public"}) },
+			kept: `"credentials":{"User":"ada","Key":"public"}`,
+		},
+		{
+			name:   "attribute in a group",
+			log:    func(l *slog.Logger) { l.WithGroup("provider").Info("call", "api_key", "configured-secret-value") },
+			secret: "configured-secret-value",
+			kept:   `"provider":{"api_key":"[redacted]"}`,
+		},
+		{
+			name:   "attribute added to the logger",
+			log:    func(l *slog.Logger) { l.With("body", "configured-secret-value").Info("call") },
+			secret: "configured-secret-value",
+			kept:   `"body":"[redacted]"`,
+		},
+		{
+			name: "short values are not secrets",
+			log:  func(l *slog.Logger) { l.Info("short test value") },
+			kept: "short test value",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			logger := New(config.LogConfig{Level: "info", Format: config.LogFormatJSON}, &out,
+				NewRedactor([]string{"configured-secret-value", "test", ""}))
+			tt.log(logger)
+
+			if tt.secret != "" && strings.Contains(out.String(), tt.secret) {
+				t.Errorf("output contains %q: %s", tt.secret, out.String())
+			}
+			if !strings.Contains(out.String(), tt.kept) {
+				t.Errorf("output does not contain %q: %s", tt.kept, out.String())
+			}
+		})
+	}
+}
+
+func TestRedactorAdd(t *testing.T) {
+	var out bytes.Buffer
+	redactor := NewRedactor(nil)
+	logger := New(config.LogConfig{Level: "info", Format: config.LogFormatText}, &out, redactor)
+
+	redactor.Add([]string{"first-rotated-key"})
+	redactor.Add([]string{"second-rotated-key"})
+	logger.Info("keys", "old", "first-rotated-key", "new", "second-rotated-key")
+
+	// Secrets added earlier stay redacted after later additions
+	for _, secret := range []string{"first-rotated-key", "second-rotated-key"} {
+		if strings.Contains(out.String(), secret) {
+			t.Errorf("output contains %q: %s", secret, out.String())
+		}
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var out bytes.Buffer
+	logger := New(config.LogConfig{Level: "warn", Format: config.LogFormatJSON}, &out, NewRedactor(nil))
+
+	ctx := WithRequestID(context.Background(), "req-123")
+	logger.InfoContext(ctx, "below the level")
+	logger.WarnContext(ctx, "with request")
+	logger.Warn("without request")
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d lines, want 2: %s", len(lines), out.String())
+	}
+	if !strings.Contains(lines[0], `"request_id":"req-123"`) {
+		t.Errorf("line with a request = %s, want its request ID", lines[0])
+	}
+	if strings.Contains(lines[1], "request_id") {
+		t.Errorf("line without a request = %s, want no request ID", lines[1])
+	}
+}
@@ -1,12 +1,24 @@
 package main
 
 import (
-	"log"
-	"net"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
 	"os"
-	"strconv"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
+	"sample-api/config"
 	"sample-api/controllers"
+	"sample-api/logging"
+	"sample-api/metrics"
+	"sample-api/middleware"
 	"sample-api/models"
 	"sample-api/services"
 
@@ -15,71 +27,330 @@ import (
 	"github.com/joho/godotenv"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
 func main() {
+	// Load environment variables from .env file if it exists
+	godotenv.Load()
+
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] == "config" {
+		os.Exit(runConfigCommand(args[1:]))
+	}
+
+	cfg, err := config.Load(os.Args[0], args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		// Configuration problems are listed one per line, which reads best unstructured
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	redactor := logging.NewRedactor(cfg.Secrets())
+	slog.SetDefault(logging.New(cfg.Log, os.Stderr, redactor))
+	gin.DebugPrintFunc = func(format string, values ...any) {
+		slog.Debug(strings.TrimSpace(fmt.Sprintf(format, values...)))
+	}
+
 	// Initialize database
-	db, err := gorm.Open(sqlite.Open("users.db"), &gorm.Config{})
+	// TranslateError turns driver-specific errors such as unique violations into gorm errors
+	db, err := gorm.Open(sqlite.Open(cfg.Database.Path), &gorm.Config{
+		TranslateError: true,
+		Logger: logger.New(slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn), logger.Config{
+			SlowThreshold:             200 * time.Millisecond,
+			LogLevel:                  logger.Warn,
+			IgnoreRecordNotFoundError: true,
+		}),
+	})
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		fatal("Failed to connect to database", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		metrics.RegisterDB(sqlDB, "main")
 	}
 
-	// Load environment variables from .env file if it exists
-	godotenv.Load()
+	encryptor, err := services.NewEncryptor(cfg.Encryption)
+	if err != nil {
+		fatal("Failed to set up encryption", err)
+	}
+	if err := services.SealOrganizationCredentials(db, encryptor); err != nil {
+		fatal("Failed to encrypt organization credentials", err)
+	}
 
 	// Auto-migrate models
-	db.AutoMigrate(&models.User{})
+	db.AutoMigrate(&models.User{}, &models.MediaFile{}, &models.RefreshToken{}, &models.APIKey{}, &models.UserToken{},
+		&models.OIDCIdentity{}, &models.OIDCLoginState{}, &models.Organization{}, &models.Membership{},
+		&models.Invite{}, &models.OrganizationCredential{}, &models.UsageRecord{}, &models.AuditRecord{},
+		&models.UserCredential{})
 
 	// Initialize services
-	userService := services.NewUserService(db)
+	userService := services.NewUserService(db, cfg.Auth)
+	if err := userService.PromoteAdmins(); err != nil {
+		fatal("Failed to promote admin users", err)
+	}
+	authService := services.NewAuthService(db, userService, cfg.Auth)
+	apiKeyService := services.NewAPIKeyService(db, userService)
+	accountService := services.NewAccountService(db, userService, authService, cfg.Account, cfg.Mail, cfg.Server.PublicBaseURL)
+	oidcService := services.NewOIDCService(db, userService, authService, cfg.OIDC)
+	userCredentialService := services.NewUserCredentialService(db, encryptor)
+	orgService := services.NewOrganizationService(db, userCredentialService, encryptor, cfg.Organizations, cfg.Mail)
+	privacyService := services.NewPrivacyService(db)
 	youtubeService := services.NewYouTubeService()
+	audioService := services.NewAudioService()
+	mediaService := services.NewMediaService(db, cfg.Media)
+	mediaService.StartJanitor(time.Minute)
 
-	// Initialize AI service (default to OpenAI, can be overridden with AI_PROVIDER env var)
-	aiProvider := os.Getenv("AI_PROVIDER")
-	if aiProvider == "" {
-		aiProvider = "openai"
-	}
-	aiService := services.NewAIService(aiProvider)
+	// Initialize AI service for the configured default provider
+	aiService := services.NewAIService(cfg.AI)
+	reloadKeysOnHangup(args, aiService, redactor)
+	transcriptionService := services.NewTranscriptionService(aiService, audioService, cfg.Transcription)
+	captionService := services.NewCaptionService(aiService)
 
 	// Initialize controllers
 	userController := controllers.NewUserController(userService)
-	youtubeController := controllers.NewYouTubeController(youtubeService)
-	aiController := controllers.NewAIController(aiService)
+	authController := controllers.NewAuthController(authService, accountService)
+	apiKeyController := controllers.NewAPIKeyController(apiKeyService)
+	userCredentialController := controllers.NewUserCredentialController(userCredentialService)
+	oidcController := controllers.NewOIDCController(oidcService)
+	orgController := controllers.NewOrganizationController(orgService)
+	privacyController := controllers.NewPrivacyController(privacyService)
+	youtubeController := controllers.NewYouTubeController(youtubeService, audioService, mediaService, orgService)
+	fileController := controllers.NewFileController(mediaService)
+	aiController := controllers.NewAIController(aiService, transcriptionService, captionService, mediaService, orgService)
 
 	// Setup Gin router
-	r := gin.Default()
+	r := gin.New()
+	// Without trusted proxies, X-Forwarded-For is ignored and ClientIP is the peer address
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		fatal("Invalid trusted proxies", err)
+	}
+	r.Use(middleware.RequestID(), middleware.Metrics(), middleware.RequestLogger(), middleware.Recovery())
 
 	// CORS middleware
 	r.Use(cors.Default())
+	r.Use(middleware.PublicBaseURL(cfg.Server.PublicBaseURL))
+
+	if cfg.Metrics.Enabled {
+		if cfg.Metrics.Token == "" {
+			slog.Warn("metrics.token is not configured, /metrics is readable by anyone")
+		}
+		r.GET("/metrics", middleware.RequireMetricsToken(cfg.Metrics.Token), gin.WrapH(metrics.Handler()))
+	}
+
+	// Public routes
+	r.POST("/auth/register", authController.Register)
+	r.POST("/auth/login", authController.Login)
+	r.POST("/auth/refresh", authController.Refresh)
+	r.POST("/auth/logout", authController.Logout)
+	r.GET("/auth/verify-email", authController.VerifyEmail)
+	r.POST("/auth/verify-email", authController.VerifyEmail)
+	r.POST("/auth/forgot-password", authController.ForgotPassword)
+	r.POST("/auth/reset-password", authController.ResetPassword)
+	r.GET("/auth/oidc/login", oidcController.Login)
+	r.GET("/auth/oidc/callback", oidcController.Callback)
+	r.GET("/files/:id", fileController.DownloadFile)
+
+	// Routes below require an access token or an API key with the route's scope
+	protected := r.Group("/", middleware.RequireAuth(authService, apiKeyService))
+	protected.GET("/auth/me", authController.Me)
+	protected.POST("/auth/verify-email/resend", authController.ResendVerification)
+
+	// API key management is only available to interactive sessions
+	apiKeys := protected.Group("/users/me/api-keys", middleware.RequireSession())
+	apiKeys.GET("", apiKeyController.ListAPIKeys)
+	apiKeys.POST("", apiKeyController.CreateAPIKey)
+	apiKeys.PATCH("/:keyId", apiKeyController.UpdateAPIKey)
+	apiKeys.DELETE("/:keyId", apiKeyController.RevokeAPIKey)
+
+	// Users' own provider keys, used for their AI requests
+	credentials := protected.Group("/users/me/credentials", middleware.RequireSession())
+	credentials.GET("", userCredentialController.ListCredentials)
+	credentials.PUT("/:provider", userCredentialController.SetCredential)
+	credentials.DELETE("/:provider", userCredentialController.DeleteCredential)
+
+	protected.GET("/users/me/preferences", middleware.RequireScope(services.ScopeUsersRead), userController.GetPreferences)
+	protected.PUT("/users/me/preferences", middleware.RequireScope(services.ScopeUsersWrite), userController.UpdatePreferences)
+	protected.GET("/users/me/export", middleware.RequireScope(services.ScopeUsersRead), privacyController.ExportMyData)
+
+	// Users can read and edit their own account; everything else needs users:manage
+	usersRead := protected.Group("/users", middleware.RequireScope(services.ScopeUsersRead))
+	usersRead.GET("", middleware.RequirePermission(services.PermUsersManage), userController.GetUsers)
+	usersRead.GET("/export", middleware.RequirePermission(services.PermUsersManage), userController.ExportUsers)
+	usersRead.GET("/:id", userController.GetUser)
+
+	usersWrite := protected.Group("/users", middleware.RequireScope(services.ScopeUsersWrite))
+	usersWrite.PATCH("/:id", userController.UpdateUser)
+	usersWrite.DELETE("/:id", userController.DeleteUser)
+	usersWrite.POST("/:id/erase", middleware.RequireSession(), privacyController.EraseUser)
+
+	usersAdmin := usersWrite.Group("", middleware.RequirePermission(services.PermUsersManage))
+	usersAdmin.POST("", userController.CreateUser)
+	usersAdmin.POST("/import", userController.ImportUsers)
+	usersAdmin.POST("/:id/restore", userController.RestoreUser)
+	usersAdmin.DELETE("/:id/purge", userController.PurgeUser)
+
+	// Organizations; members see their organization, admins manage it. API keys may
+	// only read them, since membership, invites and credentials grant access to others
+	orgsRead := protected.Group("/orgs", middleware.RequireScope(services.ScopeOrgsRead))
+	orgsRead.GET("", orgController.ListOrganizations)
 
-	// Routes
-	r.GET("/users", userController.GetUsers)
-	r.POST("/users", userController.CreateUser)
-	r.POST("/extract-audio", youtubeController.ExtractAudio)
+	orgsWrite := protected.Group("/orgs", middleware.RequireSession())
+	orgsWrite.POST("", orgController.CreateOrganization)
+	protected.POST("/invites/accept", middleware.RequireSession(), orgController.AcceptInvite)
+
+	org := orgsRead.Group("/:orgId", middleware.RequireOrganization(orgService))
+	org.GET("", orgController.GetOrganization)
+	org.GET("/members", orgController.ListMembers)
+	org.GET("/usage", orgController.GetUsage)
+
+	orgManage := orgsWrite.Group("/:orgId", middleware.RequireOrganization(orgService))
+	orgManage.DELETE("/members/:userId", orgController.RemoveMember)
+	orgManage.PUT("/quota", middleware.RequirePermission(services.PermUsersManage), orgController.UpdateQuota)
+
+	orgAdmin := orgManage.Group("", middleware.RequireOrgRole(models.OrgRoleAdmin))
+	orgAdmin.PATCH("", orgController.UpdateOrganization)
+	orgAdmin.PATCH("/members/:userId", orgController.UpdateMember)
+	orgAdmin.GET("/invites", orgController.ListInvites)
+	orgAdmin.POST("/invites", orgController.CreateInvite)
+	orgAdmin.DELETE("/invites/:inviteId", orgController.RevokeInvite)
+	orgAdmin.GET("/credentials", orgController.ListCredentials)
+	orgAdmin.PUT("/credentials/:provider", orgController.SetCredential)
+	orgAdmin.DELETE("/credentials/:provider", orgController.DeleteCredential)
+
+	// Metered routes act in the organization named by X-Organization-ID (or the user's first one)
+	protected.POST("/extract-audio",
+		middleware.RequireScope(services.ScopeAudio),
+		middleware.RequirePermission(services.PermAudioExtract),
+		middleware.RequireOrganization(orgService),
+		middleware.EnforceQuota(orgService),
+		youtubeController.ExtractAudio)
 
 	// AI Routes
-	r.POST("/ai/prompt", aiController.PromptAI)
-	r.POST("/ai/analyze", aiController.AnalyzeYouTubeContent)
-	r.POST("/ai/summarize", aiController.GenerateSummary)
+	ai := protected.Group("/ai",
+		middleware.RequireScope(services.ScopeAI),
+		middleware.RequirePermission(services.PermAIUse),
+		middleware.RequireVerifiedEmail(accountService),
+		middleware.RequireOrganization(orgService),
+		middleware.EnforceQuota(orgService))
+	ai.POST("/prompt", aiController.PromptAI)
+	ai.POST("/analyze", aiController.AnalyzeYouTubeContent)
+	ai.POST("/summarize", aiController.GenerateSummary)
+	ai.POST("/transcribe", aiController.TranscribeAudio)
+	ai.POST("/captions", aiController.GenerateCaptions)
 
-	// Get port from environment or use default
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	listener, err := listen(cfg.Server)
+	if err != nil {
+		fatal("Failed to listen", err)
+	}
+	addr := describe(listener)
+	if cfg.Server.AddressFile != "" {
+		if err := announce(addr, cfg.Server.AddressFile); err != nil {
+			fatal("Failed to announce address", err)
+		}
+		defer removeAnnouncement(cfg.Server.AddressFile)
 	}
 
-	// Try to bind to the port, if occupied, find a random available port
-	listener, err := net.Listen("tcp", ":"+port)
-	if err != nil {
-		// Port is occupied, find a random available port
-		listener, err = net.Listen("tcp", ":0")
-		if err != nil {
-			log.Fatal("Failed to find available port:", err)
+	srv := &http.Server{Handler: r, ReadHeaderTimeout: 10 * time.Second}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+	slog.Info("Server listening", "network", addr.Network, "address", addr.Address)
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-serveErr:
+		// fatal exits without running deferred calls
+		removeAnnouncement(cfg.Server.AddressFile)
+		fatal("Server failed", err)
+	case sig := <-stop:
+		slog.Info("Shutting down", "signal", sig.String())
+	}
+	// A second signal stops the process right away
+	signal.Stop(stop)
+
+	shutdown(srv, cfg.Server.ShutdownTimeout, youtubeService, mediaService, db)
+}
+
+// shutdown stops accepting requests and lets running ones finish within timeout. Running
+// extractions are killed after that, then background work is stopped and the database
+// closed.
+func shutdown(srv *http.Server, timeout time.Duration, youtubeService *services.YouTubeService, mediaService *services.MediaService, db *gorm.DB) {
+	youtubeService.Drain()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Warn("Requests still running, cancelling extractions", "timeout", timeout)
+		youtubeService.Cancel()
+
+		// Handlers return quickly once their extraction is killed; drop whatever is left
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
 		}
-		port = strconv.Itoa(listener.Addr().(*net.TCPAddr).Port)
 	}
-	listener.Close()
 
-	log.Printf("Server starting on port %s", port)
-	r.Run(":" + port)
+	mediaService.StopJanitor()
+	youtubeService.Cleanup()
+	if sqlDB, err := db.DB(); err == nil {
+		if err := sqlDB.Close(); err != nil {
+			slog.Error("Failed to close database", "error", err)
+		}
+	}
+	slog.Info("Server stopped")
+}
+
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// reloadKeysOnHangup reloads the AI provider keys when the process receives SIGHUP, so
+// rotated keys in the config file or in *_FILE secrets are used without a restart. The
+// new keys are redacted from logs too. Other settings only change on restart.
+func reloadKeysOnHangup(args []string, aiService *services.AIService, redactor *logging.Redactor) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+
+	go func() {
+		for range hangup {
+			cfg, err := config.Load(os.Args[0], args, io.Discard)
+			if err != nil {
+				slog.Error("Failed to reload configuration, keeping the current AI provider keys", "error", err)
+				continue
+			}
+			redactor.Add(cfg.Secrets())
+			aiService.ReloadKeys(cfg.AI)
+			slog.Info("Reloaded AI provider keys")
+		}
+	}()
+}
+
+// runConfigCommand implements "config show", which prints the effective configuration
+// with secrets redacted. It accepts the same flags as the server.
+func runConfigCommand(args []string) int {
+	if len(args) == 0 || args[0] != "show" {
+		fmt.Fprintf(os.Stderr, "usage: %s config show [flags]\n", os.Args[0])
+		return 2
+	}
+
+	cfg, err := config.Load(os.Args[0]+" config show", args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := cfg.Write(os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
 }
@@ -0,0 +1,83 @@
+// Package metrics defines the application's Prometheus metrics and serves them
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var registry = prometheus.NewRegistry()
+
+// HTTP requests
+var (
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by method, route and status.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"method", "route", "status"})
+)
+
+// AI provider calls; operation is prompt or transcribe
+var (
+	ProviderRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ai_provider_request_duration_seconds",
+		Help:    "Latency of calls to AI provider APIs, successful or not.",
+		Buckets: []float64{.25, .5, 1, 2.5, 5, 10, 20, 40, 80, 160},
+	}, []string{"provider", "model", "operation"})
+	ProviderErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ai_provider_errors_total",
+		Help: "Failed calls to AI provider APIs, by reason: rate_limited, unauthorized, api_error, cancelled or request_failed.",
+	}, []string{"provider", "model", "operation", "reason"})
+	ProviderTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "ai_provider_tokens_total",
+		Help: "Tokens reported by AI providers, by direction: input or output.",
+	}, []string{"provider", "model", "direction"})
+)
+
+// yt-dlp extractions
+var (
+	ExtractionDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "ytdlp_job_duration_seconds",
+		Help:    "Duration of yt-dlp extractions, by outcome: success, failure or cancelled.",
+		Buckets: []float64{1, 2.5, 5, 10, 20, 40, 80, 160, 320, 640},
+	}, []string{"outcome"})
+	ExtractionsRunning = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "ytdlp_jobs_running",
+		Help: "yt-dlp extractions currently running.",
+	})
+)
+
+// CacheRequests counts lookups in in-memory caches; the hit rate is hits over all lookups
+var CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "cache_requests_total",
+	Help: "Cache lookups, by cache and result: hit or miss.",
+}, []string{"cache", "result"})
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests, HTTPRequestDuration,
+		ProviderRequestDuration, ProviderErrors, ProviderTokens,
+		ExtractionDuration, ExtractionsRunning,
+		CacheRequests,
+	)
+}
+
+// RegisterDB exports the connection pool statistics of db under the name dbName
+func RegisterDB(db *sql.DB, dbName string) {
+	registry.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"sample-api/models"
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	currentUserKey   = "currentUser"
+	currentAPIKeyKey = "currentAPIKey"
+)
+
+// RequireAuth rejects requests that do not carry valid credentials and makes the
+// authenticated user available through CurrentUser. Clients authenticate with a JWT
+// access token or an API key in "Authorization: Bearer ...", or with an API key in
+// the X-API-Key header.
+func RequireAuth(authService *services.AuthService, apiKeyService *services.APIKeyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c)
+		if !ok {
+			token = strings.TrimSpace(c.GetHeader("X-API-Key"))
+		}
+		if token == "" {
+			unauthorized(c, "Authentication required")
+			return
+		}
+
+		var (
+			user models.User
+			err  error
+		)
+		if strings.HasPrefix(token, services.APIKeyPrefix) {
+			var key models.APIKey
+			user, key, err = apiKeyService.Authenticate(token, c.ClientIP())
+			if err == nil {
+				c.Set(currentAPIKeyKey, key)
+			}
+		} else {
+			user, err = authService.Authenticate(token)
+		}
+
+		if err != nil {
+			if errors.Is(err, services.ErrInvalidToken) {
+				unauthorized(c, err.Error())
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to authenticate request"})
+			return
+		}
+
+		c.Set(currentUserKey, user)
+		c.Next()
+	}
+}
+
+// RequireScope limits API key requests to keys that were granted scope. Requests
+// authenticated with an access token are not restricted by scopes.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if key, ok := CurrentAPIKey(c); ok && !slices.Contains(key.Scopes, scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key is missing the " + scope + " scope"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSession rejects requests authenticated with an API key, for routes such as
+// key management that should only be reachable from an interactive login
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := CurrentAPIKey(c); ok {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "This endpoint cannot be called with an API key"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the user authenticated by RequireAuth
+func CurrentUser(c *gin.Context) (models.User, bool) {
+	value, ok := c.Get(currentUserKey)
+	if !ok {
+		return models.User{}, false
+	}
+	user, ok := value.(models.User)
+	return user, ok
+}
+
+// CurrentAPIKey returns the API key used to authenticate the request, if any
+func CurrentAPIKey(c *gin.Context) (models.APIKey, bool) {
+	value, ok := c.Get(currentAPIKeyKey)
+	if !ok {
+		return models.APIKey{}, false
+	}
+	key, ok := value.(models.APIKey)
+	return key, ok
+}
+
+func bearerToken(c *gin.Context) (string, bool) {
+	scheme, token, found := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+func unauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="sample-api"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": message})
+}
+
+// RequirePermission rejects requests from users whose role lacks permission
+func RequirePermission(permission services.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := CurrentUser(c)
+		if !ok || !services.HasPermission(user.Role, permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail rejects users who have not verified their email address when
+// the account service is configured to require it
+func RequireVerifiedEmail(accountService *services.AccountService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if user, ok := CurrentUser(c); accountService.RequireVerified() && (!ok || user.EmailVerifiedAt == nil) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": services.ErrEmailNotVerified.Error()})
+			return
+		}
+		c.Next()
+	}
+}
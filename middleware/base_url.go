@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const publicBaseURLKey = "publicBaseURL"
+
+// PublicBaseURL makes configured the base URL used to build absolute links. When it is
+// empty the scheme and host of each incoming request are used instead.
+func PublicBaseURL(configured string) gin.HandlerFunc {
+	configured = strings.TrimRight(configured, "/")
+	return func(c *gin.Context) {
+		if configured != "" {
+			c.Set(publicBaseURLKey, configured)
+		}
+		c.Next()
+	}
+}
+
+// BaseURL returns the externally visible base URL of the API for the current request
+func BaseURL(c *gin.Context) string {
+	if base := c.GetString(publicBaseURLKey); base != "" {
+		return base
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host
+}
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"sample-api/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+var knownMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions,
+}
+
+// Metrics counts requests and measures their latency by route and status. Requests
+// that match no route share one label so arbitrary paths cannot create new series.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request.Method
+		if !slices.Contains(knownMethods, method) {
+			method = "OTHER"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+		metrics.HTTPRequests.WithLabelValues(method, route, status).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(method, route, status).Observe(time.Since(start).Seconds())
+	}
+}
+
+// RequireMetricsToken only lets scrapers that send "Authorization: Bearer <token>" read
+// the metrics. An empty token leaves them open, e.g. when the port is not exposed.
+func RequireMetricsToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.Next()
+			return
+		}
+		given, ok := bearerToken(c)
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			unauthorized(c, "Invalid metrics token")
+			return
+		}
+		c.Next()
+	}
+}
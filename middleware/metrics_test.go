@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sample-api/metrics"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMetrics(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(Metrics())
+	r.GET("/users/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/users", func(c *gin.Context) { c.Status(http.StatusCreated) })
+	r.Handle("PROPFIND", "/users", func(c *gin.Context) { c.Status(http.StatusMethodNotAllowed) })
+
+	tests := []struct {
+		method string
+		path   string
+		// labels of the series the request must be counted in
+		labels []string
+	}{
+		// Path parameters do not create new series
+		{method: http.MethodGet, path: "/users/1", labels: []string{"GET", "/users/:id", "200"}},
+		{method: http.MethodGet, path: "/users/2", labels: []string{"GET", "/users/:id", "200"}},
+		{method: http.MethodPost, path: "/users", labels: []string{"POST", "/users", "201"}},
+		{method: http.MethodGet, path: "/no/such/path", labels: []string{"GET", "unmatched", "404"}},
+		{method: "PROPFIND", path: "/users", labels: []string{"OTHER", "/users", "405"}},
+	}
+
+	want := map[[3]string]float64{}
+	before := map[[3]string]float64{}
+	for _, tt := range tests {
+		series := [3]string(tt.labels)
+		if _, ok := before[series]; !ok {
+			before[series] = testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(tt.labels...))
+		}
+		want[series]++
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+	}
+
+	for series, count := range want {
+		got := testutil.ToFloat64(metrics.HTTPRequests.WithLabelValues(series[:]...)) - before[series]
+		if got != count {
+			t.Errorf("http_requests_total%v = %v, want %v", series, got, count)
+		}
+	}
+	if n := testutil.CollectAndCount(metrics.HTTPRequestDuration); n < len(want) {
+		t.Errorf("http_request_duration_seconds has %d series, want at least %d", n, len(want))
+	}
+}
+
+func TestRequireMetricsToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{name: "no token configured", want: http.StatusOK},
+		{name: "valid token", token: "scrape-secret", header: "Bearer scrape-secret", want: http.StatusOK},
+		{name: "missing token", token: "scrape-secret", want: http.StatusUnauthorized},
+		{name: "wrong token", token: "scrape-secret", header: "Bearer scrape-secreT", want: http.StatusUnauthorized},
+		{name: "not a bearer token", token: "scrape-secret", header: "Basic scrape-secret", want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := gin.New()
+			r.GET("/metrics", RequireMetricsToken(tt.token), gin.WrapH(metrics.Handler()))
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			body, _ := io.ReadAll(w.Body)
+			if exposed := strings.Contains(string(body), "go_goroutines"); exposed != (tt.want == http.StatusOK) {
+				t.Errorf("metrics exposed = %v, want %v", exposed, tt.want == http.StatusOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"sample-api/models"
+	"sample-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	currentOrganizationKey = "currentOrganization"
+	currentOrgRoleKey      = "currentOrgRole"
+	usageReservationKey    = "usageReservation"
+
+	// OrganizationHeader selects the organization a request acts in
+	OrganizationHeader = "X-Organization-ID"
+)
+
+// RequireOrganization resolves the organization a request acts in from the :orgId path
+// parameter or the X-Organization-ID header, defaulting to the user's first organization.
+// Organizations the user does not belong to are reported as not found.
+func RequireOrganization(orgService *services.OrganizationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := CurrentUser(c)
+
+		orgID := c.Param("orgId")
+		if orgID == "" {
+			orgID = c.GetHeader(OrganizationHeader)
+		}
+
+		org, role, err := orgService.Resolve(user, orgID)
+		if err != nil {
+			if errors.Is(err, services.ErrOrganizationNotFound) {
+				c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve organization"})
+			return
+		}
+
+		c.Set(currentOrganizationKey, org)
+		c.Set(currentOrgRoleKey, role)
+		c.Next()
+	}
+}
+
+// RequireOrgRole rejects users whose role in the current organization is below minimum.
+// It must run after RequireOrganization.
+func RequireOrgRole(minimum string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, role, _ := CurrentOrganization(c); !services.HasOrgRole(role, minimum) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": services.ErrOrgForbidden.Error()})
+			return
+		}
+		c.Next()
+	}
+}
+
+// EnforceQuota rejects requests once the current organization has used its monthly quota.
+// Each request reserves its share of the quota up front; handlers complete the
+// reservation with CompleteUsage, and reservations they leave open are refunded.
+// It must run after RequireOrganization.
+func EnforceQuota(orgService *services.OrganizationService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		org, _, _ := CurrentOrganization(c)
+		user, _ := CurrentUser(c)
+		reservation, err := orgService.ReserveUsage(org, user.ID)
+		if err != nil {
+			if errors.Is(err, services.ErrQuotaExceeded) {
+				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check quota"})
+			return
+		}
+
+		defer func() {
+			if err := orgService.RefundUsage(reservation); err != nil {
+				slog.ErrorContext(c.Request.Context(), "Failed to refund usage", "organization_id", org.ID, "error", err)
+			}
+		}()
+		c.Set(usageReservationKey, reservation)
+		c.Next()
+	}
+}
+
+// UsageReservation returns the quota reserved for the request by EnforceQuota
+func UsageReservation(c *gin.Context) (models.UsageRecord, bool) {
+	value, ok := c.Get(usageReservationKey)
+	if !ok {
+		return models.UsageRecord{}, false
+	}
+	record, ok := value.(models.UsageRecord)
+	return record, ok
+}
+
+// CurrentOrganization returns the organization set by RequireOrganization and the
+// user's role in it
+func CurrentOrganization(c *gin.Context) (models.Organization, string, bool) {
+	value, ok := c.Get(currentOrganizationKey)
+	if !ok {
+		return models.Organization{}, "", false
+	}
+	org, ok := value.(models.Organization)
+	return org, c.GetString(currentOrgRoleKey), ok
+}
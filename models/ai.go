@@ -1,9 +1,12 @@
 package models
 
+import "time"
+
 // AIPromptRequest represents a request to send a prompt to the AI platform
 type AIPromptRequest struct {
 	Prompt   string `json:"prompt" binding:"required"`
 	Provider string `json:"provider,omitempty"` // openai, google, anthropic
+	Model    string `json:"model,omitempty"`
 }
 
 // AIPromptResponse represents the response from the AI platform
@@ -17,8 +20,10 @@ type AIPromptResponse struct {
 // AIAnalysisRequest represents a request to analyze YouTube content
 type AIAnalysisRequest struct {
 	Content      string `json:"content" binding:"required"`
-	Provider     string `json:"provider,omitempty"`      // openai, google, anthropic
+	Provider     string `json:"provider,omitempty"` // openai, google, anthropic
+	Model        string `json:"model,omitempty"`
 	AnalysisType string `json:"analysis_type,omitempty"` // summary, sentiment, keywords, etc.
+	Language     string `json:"language,omitempty"`      // language to answer in
 }
 
 // AIAnalysisResponse represents the response from AI analysis
@@ -26,5 +31,58 @@ type AIAnalysisResponse struct {
 	Success  bool   `json:"success"`
 	Message  string `json:"message,omitempty"`
 	Analysis string `json:"analysis,omitempty"`
+	Strategy string `json:"strategy,omitempty"` // stuff or map_reduce, for summaries
+	Chunks   int    `json:"chunks,omitempty"`
 	Error    string `json:"error,omitempty"`
 }
+
+// TranscribeRequest represents a request to transcribe a stored audio file
+type TranscribeRequest struct {
+	FileID   string `json:"file_id" binding:"required"`
+	Language string `json:"language,omitempty"` // ISO-639-1 hint, e.g. "en"
+}
+
+// TranscriptSegment is a piece of transcribed speech with timestamps in seconds
+type TranscriptSegment struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Text  string  `json:"text"`
+}
+
+// Transcript is the full transcription of an audio file
+type Transcript struct {
+	Text     string              `json:"text"`
+	Language string              `json:"language,omitempty"`
+	Duration float64             `json:"duration"`
+	Chunks   int                 `json:"chunks"`
+	Segments []TranscriptSegment `json:"segments"`
+}
+
+// TranscribeResponse represents the response of a transcription request
+type TranscribeResponse struct {
+	Success    bool        `json:"success"`
+	Message    string      `json:"message,omitempty"`
+	Transcript *Transcript `json:"transcript,omitempty"`
+	Error      string      `json:"error,omitempty"`
+}
+
+// CaptionRequest represents a request to generate captions for a stored audio file
+type CaptionRequest struct {
+	FileID      string `json:"file_id" binding:"required"`
+	Format      string `json:"format,omitempty" binding:"omitempty,oneof=srt vtt"` // defaults to srt
+	Language    string `json:"language,omitempty"`                                 // spoken language hint
+	TranslateTo string `json:"translate_to,omitempty"`                             // translate captions into this language
+}
+
+// CaptionResponse represents the response of a caption generation request
+type CaptionResponse struct {
+	Success   bool       `json:"success"`
+	Message   string     `json:"message,omitempty"`
+	FileID    string     `json:"file_id,omitempty"`
+	FileURL   string     `json:"file_url,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Format    string     `json:"format,omitempty"`
+	Language  string     `json:"language,omitempty"`
+	Cues      int        `json:"cues,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
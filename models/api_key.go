@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// APIKey lets machine clients authenticate as a user. Only a hash of the key is stored;
+// the plaintext is shown once when the key is created.
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"-" gorm:"index;not null"`
+	Label      string     `json:"label" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null"` // first characters of the key, for identification
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     []string   `json:"scopes" gorm:"serializer:json"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest represents a request to create an API key
+type CreateAPIKeyRequest struct {
+	Label  string   `json:"label" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1,dive,oneof=ai audio orgs:read users:read users:write"`
+}
+
+// UpdateAPIKeyRequest represents a request to relabel an API key
+type UpdateAPIKeyRequest struct {
+	Label string `json:"label" binding:"required,max=100"`
+}
+
+// CreateAPIKeyResponse includes the plaintext key, which is never returned again
+type CreateAPIKeyResponse struct {
+	APIKey
+	Key string `json:"key"`
+}
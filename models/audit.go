@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// Audit actions
+const (
+	AuditActionUserErased = "user.erased"
+)
+
+// AuditRecord records a sensitive operation. It must not contain personal data of the
+// subject, since it outlives them; Details holds counts and other non-identifying facts.
+type AuditRecord struct {
+	ID        uint             `json:"id" gorm:"primaryKey"`
+	Action    string           `json:"action" gorm:"index;not null"`
+	ActorID   uint             `json:"actor_id"`
+	SubjectID uint             `json:"subject_id" gorm:"index"`
+	Details   map[string]int64 `json:"details" gorm:"serializer:json"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// EraseUserRequest confirms an erasure by repeating the account's email address
+type EraseUserRequest struct {
+	Confirm string `json:"confirm" binding:"required"`
+}
+
+func (r *EraseUserRequest) Normalize() {
+	r.Confirm = NormalizeEmail(r.Confirm)
+}
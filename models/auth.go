@@ -0,0 +1,92 @@
+package models
+
+import "time"
+
+// RefreshToken is a server-side record of an issued refresh token. Tokens are rotated on
+// every use; all tokens descending from the same login share a FamilyID so that reuse of
+// a rotated token can revoke the whole chain.
+type RefreshToken struct {
+	ID        uint      `gorm:"primaryKey"`
+	UserID    uint      `gorm:"index;not null"`
+	TokenHash string    `gorm:"uniqueIndex;not null"`
+	FamilyID  string    `gorm:"index;not null"`
+	ExpiresAt time.Time `gorm:"not null"`
+	RevokedAt *time.Time
+	CreatedAt time.Time
+}
+
+// User token purposes
+const (
+	TokenPurposeVerifyEmail   = "verify_email"
+	TokenPurposeResetPassword = "reset_password"
+)
+
+// UserToken is a single-use, expiring token sent to a user by email. Only its hash is
+// stored. Email is the address it was sent to; the token only proves ownership of that
+// address and is void once the user's address changes.
+type UserToken struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Purpose   string `gorm:"index;not null"`
+	TokenHash string `gorm:"uniqueIndex;not null"`
+	Email     string
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// RegisterRequest represents a request to create an account with a password
+type RegisterRequest struct {
+	Name     string `json:"name" binding:"required,max=100"`
+	Email    string `json:"email" binding:"required,max=254,email"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+func (r *RegisterRequest) Normalize() {
+	r.Name = NormalizeName(r.Name)
+	r.Email = NormalizeEmail(r.Email)
+}
+
+// LoginRequest represents a password login
+type LoginRequest struct {
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+func (r *LoginRequest) Normalize() {
+	r.Email = NormalizeEmail(r.Email)
+}
+
+// RefreshRequest carries a refresh token to rotate or revoke
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// TokenResponse is returned whenever a new token pair is issued
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"` // access token lifetime in seconds
+	User         *User  `json:"user,omitempty"`
+}
+
+// VerifyEmailRequest carries an email verification token
+type VerifyEmailRequest struct {
+	Token string `json:"token" form:"token" binding:"required"`
+}
+
+// ForgotPasswordRequest starts a password reset
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required"`
+}
+
+func (r *ForgotPasswordRequest) Normalize() {
+	r.Email = NormalizeEmail(r.Email)
+}
+
+// ResetPasswordRequest sets a new password using a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
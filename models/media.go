@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// MediaFile is a file produced by the API (extracted audio, etc.) that can be
+// downloaded later through a signed, expiring link
+type MediaFile struct {
+	ID             string    `json:"id" gorm:"primaryKey"`
+	OwnerID        uint      `json:"owner_id" gorm:"index"`
+	OrganizationID uint      `json:"organization_id" gorm:"index"`
+	Path           string    `json:"-" gorm:"not null"`
+	Filename       string    `json:"filename" gorm:"not null"`
+	ContentType    string    `json:"content_type"`
+	Size           int64     `json:"size"`
+	CreatedAt      time.Time `json:"created_at"`
+	ExpiresAt      time.Time `json:"expires_at" gorm:"index"`
+	// Transcript is kept once the file has been transcribed so that later requests for it
+	// do not pay for transcription again. TranscriptLanguage is the language hint it was
+	// made with.
+	Transcript         *Transcript `json:"-" gorm:"serializer:json"`
+	TranscriptLanguage string      `json:"-"`
+}
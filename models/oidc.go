@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// OIDCIdentity links a user to an account at an OpenID Connect identity provider
+type OIDCIdentity struct {
+	ID        uint   `gorm:"primaryKey"`
+	UserID    uint   `gorm:"index;not null"`
+	Issuer    string `gorm:"uniqueIndex:idx_oidc_issuer_subject;not null"`
+	Subject   string `gorm:"uniqueIndex:idx_oidc_issuer_subject;not null"`
+	Email     string
+	CreatedAt time.Time
+}
+
+func (OIDCIdentity) TableName() string { return "oidc_identities" }
+
+// OIDCLoginState holds what a login started with /auth/oidc/login needs to finish it in
+// the callback. It is deleted when used and only its state's hash is stored.
+type OIDCLoginState struct {
+	StateHash    string    `gorm:"primaryKey"`
+	Nonce        string    `gorm:"not null"`
+	CodeVerifier string    `gorm:"not null"`
+	RedirectURL  string    `gorm:"not null"`
+	ExpiresAt    time.Time `gorm:"index;not null"`
+}
+
+func (OIDCLoginState) TableName() string { return "oidc_login_states" }
+
+// OIDCCallbackRequest is the query string the identity provider redirects back with
+type OIDCCallbackRequest struct {
+	Code             string `form:"code"`
+	State            string `form:"state" binding:"required"`
+	Error            string `form:"error"`
+	ErrorDescription string `form:"error_description"`
+}
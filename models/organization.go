@@ -0,0 +1,148 @@
+package models
+
+import "time"
+
+// Organization roles
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// Organization is a workspace shared by a team. Media, usage and provider credentials
+// belong to an organization, and members only see their own organization's data.
+type Organization struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"not null"`
+	// AIProvider selects the provider used for this organization's AI requests; empty
+	// means the server default
+	AIProvider string `json:"ai_provider"`
+	// MonthlyRequestQuota limits AI and audio requests per calendar month; 0 is unlimited
+	MonthlyRequestQuota int       `json:"monthly_request_quota"`
+	CreatedAt           time.Time `json:"created_at"`
+	UpdatedAt           time.Time `json:"updated_at"`
+}
+
+// Membership gives a user a role in an organization
+type Membership struct {
+	ID             uint          `json:"id" gorm:"primaryKey"`
+	OrganizationID uint          `json:"organization_id" gorm:"uniqueIndex:idx_membership_org_user;not null"`
+	UserID         uint          `json:"user_id" gorm:"uniqueIndex:idx_membership_org_user;index;not null"`
+	Role           string        `json:"role" gorm:"not null"`
+	User           *User         `json:"user,omitempty"`
+	Organization   *Organization `json:"organization,omitempty"`
+	CreatedAt      time.Time     `json:"created_at"`
+}
+
+// Invite asks someone to join an organization. It is accepted with the emailed token by
+// a user with the invited email address; only the token's hash is stored.
+type Invite struct {
+	ID             uint       `json:"id" gorm:"primaryKey"`
+	OrganizationID uint       `json:"organization_id" gorm:"index;not null"`
+	Email          string     `json:"email" gorm:"not null"`
+	Role           string     `json:"role" gorm:"not null"`
+	TokenHash      string     `json:"-" gorm:"uniqueIndex;not null"`
+	InvitedByID    uint       `json:"invited_by_id"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	AcceptedAt     *time.Time `json:"accepted_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// OrganizationCredential is an organization's own API key for an AI provider. The key
+// is stored encrypted and never returned; KeyHint shows its last characters so it can
+// be recognised.
+type OrganizationCredential struct {
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	OrganizationID uint         `json:"organization_id" gorm:"uniqueIndex:idx_org_credential_provider;not null"`
+	Provider       string       `json:"provider" gorm:"uniqueIndex:idx_org_credential_provider;not null"`
+	Key            SealedSecret `json:"-" gorm:"embedded;embeddedPrefix:key_"`
+	KeyHint        string       `json:"key_hint"`
+	Model          string       `json:"model"`
+	CreatedAt      time.Time    `json:"created_at"`
+	UpdatedAt      time.Time    `json:"updated_at"`
+}
+
+// Usage kinds
+const (
+	UsageKindPrompt       = "prompt"
+	UsageKindAnalyze      = "analyze"
+	UsageKindSummarize    = "summarize"
+	UsageKindTranscribe   = "transcribe"
+	UsageKindCaptions     = "captions"
+	UsageKindExtractAudio = "extract_audio"
+
+	// UsageKindReserved counts a request against the quota while it is in progress
+	UsageKindReserved = "reserved"
+)
+
+// UsageRecord is one metered request made on behalf of an organization
+type UsageRecord struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	OrganizationID uint      `json:"organization_id" gorm:"index:idx_usage_org_created;not null"`
+	UserID         uint      `json:"user_id" gorm:"index"`
+	Kind           string    `json:"kind" gorm:"not null"`
+	Provider       string    `json:"provider"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index:idx_usage_org_created"`
+}
+
+// UsageSummary counts an organization's requests per kind over a period
+type UsageSummary struct {
+	OrganizationID uint             `json:"organization_id"`
+	From           time.Time        `json:"from"`
+	To             time.Time        `json:"to"`
+	Total          int64            `json:"total"`
+	ByKind         map[string]int64 `json:"by_kind"`
+	Quota          int              `json:"monthly_request_quota"`
+}
+
+// CreateOrganizationRequest creates an organization owned by the caller
+type CreateOrganizationRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+}
+
+func (r *CreateOrganizationRequest) Normalize() {
+	r.Name = NormalizeName(r.Name)
+}
+
+// UpdateOrganizationRequest changes organization settings; omitted fields are left unchanged
+type UpdateOrganizationRequest struct {
+	Name       *string `json:"name,omitempty" binding:"omitnil,notblank,max=100"`
+	AIProvider *string `json:"ai_provider,omitempty" binding:"omitnil,omitempty,oneof=openai google anthropic"`
+}
+
+func (r *UpdateOrganizationRequest) Normalize() {
+	if r.Name != nil {
+		*r.Name = NormalizeName(*r.Name)
+	}
+}
+
+// UpdateQuotaRequest sets an organization's quota (server admins only)
+type UpdateQuotaRequest struct {
+	MonthlyRequestQuota int `json:"monthly_request_quota" binding:"min=0"`
+}
+
+// CreateInviteRequest invites an email address to an organization
+type CreateInviteRequest struct {
+	Email string `json:"email" binding:"required,max=254,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin member"`
+}
+
+func (r *CreateInviteRequest) Normalize() {
+	r.Email = NormalizeEmail(r.Email)
+}
+
+// AcceptInviteRequest carries an invite token
+type AcceptInviteRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// UpdateMembershipRequest changes a member's role
+type UpdateMembershipRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member"`
+}
+
+// SetCredentialRequest stores an organization's API key for a provider
+type SetCredentialRequest struct {
+	APIKey string `json:"api_key" binding:"required,max=500"`
+	Model  string `json:"model" binding:"max=100"`
+}
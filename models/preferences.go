@@ -0,0 +1,18 @@
+package models
+
+import "strings"
+
+// UserPreferences are a user's defaults for AI requests. They apply whenever a request
+// leaves the corresponding value out; empty fields fall back to the server defaults.
+type UserPreferences struct {
+	Provider      string   `json:"provider" binding:"omitempty,oneof=openai google anthropic"`
+	Model         string   `json:"model" binding:"max=100"`
+	SummaryLength string   `json:"summary_length" binding:"omitempty,oneof=short medium long"`
+	Language      string   `json:"language" binding:"omitempty,max=35"` // e.g. "en" or "pt-BR"
+	AnalysisTypes []string `json:"analysis_types" binding:"max=10,dive,oneof=summary sentiment keywords topics key_points action_items"`
+}
+
+func (p *UserPreferences) Normalize() {
+	p.Model = strings.TrimSpace(p.Model)
+	p.Language = strings.TrimSpace(p.Language)
+}
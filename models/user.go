@@ -1,9 +1,71 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// User roles
+const (
+	RoleAdmin  = "admin"
+	RoleMember = "member"
+	RoleViewer = "viewer"
+)
 
 type User struct {
 	gorm.Model
-	Name  string `json:"name" gorm:"not null"`
-	Email string `json:"email" gorm:"unique;not null"`
+	Name            string     `json:"name" gorm:"not null"`
+	Email           string     `json:"email" gorm:"unique;not null"`
+	Role            string     `json:"role" gorm:"not null;default:member"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PasswordHash    string     `json:"-"`
+	// Preferences are served by /users/me/preferences rather than with the user
+	Preferences UserPreferences `json:"-" gorm:"serializer:json"`
+}
+
+// BeforeSave keeps stored names and emails normalized whichever way the user was created
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	u.Name = NormalizeName(u.Name)
+	u.Email = NormalizeEmail(u.Email)
+	return nil
+}
+
+// CreateUserRequest represents a request to create a user without a password
+type CreateUserRequest struct {
+	Name  string `json:"name" binding:"required,max=100"`
+	Email string `json:"email" binding:"required,max=254,email"`
+	Role  string `json:"role" binding:"omitempty,oneof=admin member viewer"`
+}
+
+func (r *CreateUserRequest) Normalize() {
+	r.Name = NormalizeName(r.Name)
+	r.Email = NormalizeEmail(r.Email)
+}
+
+// UpdateUserRequest represents a partial update of a user; omitted fields are left unchanged
+type UpdateUserRequest struct {
+	Name  *string `json:"name,omitempty" binding:"omitnil,notblank,max=100"`
+	Email *string `json:"email,omitempty" binding:"omitnil,notblank,max=254,email"`
+	Role  *string `json:"role,omitempty" binding:"omitnil,oneof=admin member viewer"` // admins only
+}
+
+func (r *UpdateUserRequest) Normalize() {
+	if r.Name != nil {
+		*r.Name = NormalizeName(*r.Name)
+	}
+	if r.Email != nil {
+		*r.Email = NormalizeEmail(*r.Email)
+	}
+}
+
+// NormalizeName trims surrounding whitespace and collapses runs of inner whitespace
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(name), " ")
+}
+
+// NormalizeEmail trims and lowercases an email address so it can be compared and stored uniformly
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
 }
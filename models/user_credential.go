@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// SealedSecret is a secret encrypted with its own data key, which is in turn encrypted
+// with the master key identified by KeyID
+type SealedSecret struct {
+	KeyID      string `json:"-" gorm:"not null"`
+	DataKey    []byte `json:"-" gorm:"not null"`
+	Ciphertext []byte `json:"-" gorm:"not null"`
+}
+
+// UserCredential is a user's own API key for an AI provider, used for their requests so
+// they are billed to the user's vendor account. The key is stored encrypted and never
+// returned; KeyHint shows its last characters so it can be recognised.
+type UserCredential struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	UserID    uint         `json:"-" gorm:"uniqueIndex:idx_user_credential_provider;not null"`
+	Provider  string       `json:"provider" gorm:"uniqueIndex:idx_user_credential_provider;not null"`
+	Key       SealedSecret `json:"-" gorm:"embedded;embeddedPrefix:key_"`
+	KeyHint   string       `json:"key_hint"`
+	Model     string       `json:"model"`
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+}
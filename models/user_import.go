@@ -0,0 +1,44 @@
+package models
+
+// User import modes
+const (
+	ImportModeAtomic     = "atomic"      // nothing is imported unless every row succeeds
+	ImportModeBestEffort = "best_effort" // valid rows are imported, failing rows are reported
+)
+
+// User import row statuses
+const (
+	ImportStatusCreated  = "created"
+	ImportStatusValid    = "valid" // dry run: the row would have been created
+	ImportStatusInvalid  = "invalid"
+	ImportStatusConflict = "conflict"
+	ImportStatusSkipped  = "skipped" // atomic import aborted by another row
+)
+
+// UserImportRow is one parsed row of an import file. Errors holds problems found while
+// parsing or validating; rows with errors are never written.
+type UserImportRow struct {
+	Line   int
+	User   CreateUserRequest
+	Errors []FieldError
+}
+
+// UserImportResult reports what happened to one row of an import file
+type UserImportResult struct {
+	Line   int          `json:"line"`
+	Email  string       `json:"email,omitempty"`
+	Status string       `json:"status"`
+	UserID uint         `json:"user_id,omitempty"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+// UserImportResponse summarizes an import
+type UserImportResponse struct {
+	Mode      string             `json:"mode"`
+	DryRun    bool               `json:"dry_run"`
+	Committed bool               `json:"committed"`
+	Total     int                `json:"total"`
+	Created   int                `json:"created"`
+	Failed    int                `json:"failed"`
+	Results   []UserImportResult `json:"results"`
+}
@@ -0,0 +1,9 @@
+package models
+
+// FieldError describes why one request field was rejected. Code is stable and meant
+// for clients to switch on; Message is for humans.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -1,11 +1,41 @@
 package models
 
+import "time"
+
 type ExtractAudioRequest struct {
 	URL string `json:"url" binding:"required"`
+	AudioProcessingOptions
+}
+
+// AudioProcessingOptions controls the optional ffmpeg post-processing applied after extraction
+type AudioProcessingOptions struct {
+	Normalize   bool               `json:"normalize,omitempty"`    // EBU R128 loudness normalization
+	TrimSilence bool               `json:"trim_silence,omitempty"` // remove leading/trailing silence
+	Chunk       *AudioChunkOptions `json:"chunk,omitempty"`
+}
+
+// AudioChunkOptions describes how processed audio is split into separate files
+type AudioChunkOptions struct {
+	Mode             string  `json:"mode" binding:"required,oneof=fixed silence"`
+	Length           float64 `json:"length,omitempty" binding:"omitempty,gte=1"`  // seconds; exact length for fixed, maximum for silence
+	SilenceThreshold float64 `json:"silence_threshold,omitempty" binding:"lte=0"` // dBFS, silence mode only (default -35)
+	MinSilence       float64 `json:"min_silence,omitempty" binding:"gte=0"`       // seconds, silence mode only (default 0.5)
+}
+
+// AudioChunk is one piece of split audio, stored as its own downloadable file
+type AudioChunk struct {
+	FileID   string  `json:"file_id"`
+	FileURL  string  `json:"file_url"`
+	Start    float64 `json:"start"`
+	Duration float64 `json:"duration"`
 }
 
 type ExtractAudioResponse struct {
-	Success bool   `json:"success"`
-	Message string `json:"message,omitempty"`
-	FileURL string `json:"file_url,omitempty"`
+	Success   bool         `json:"success"`
+	Message   string       `json:"message,omitempty"`
+	FileID    string       `json:"file_id,omitempty"`
+	FileURL   string       `json:"file_url,omitempty"`
+	ExpiresAt *time.Time   `json:"expires_at,omitempty"`
+	Duration  float64      `json:"duration,omitempty"`
+	Chunks    []AudioChunk `json:"chunks,omitempty"`
 }
@@ -0,0 +1,269 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+	"sample-api/services/mailer"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrEmailNotVerified = errors.New("email address has not been verified")
+	// Links in emails are never built from request headers, which clients control
+	ErrEmailLinksDisabled    = errors.New("verification emails are disabled until server.public_base_url is configured")
+	ErrPasswordResetDisabled = errors.New("password reset is disabled until account.password_reset_url is configured")
+)
+
+// AccountService handles email verification and password resets using single-use,
+// expiring tokens delivered by email
+type AccountService struct {
+	db               *gorm.DB
+	userService      *UserService
+	authService      *AuthService
+	mailer           mailer.Mailer
+	publicBaseURL    string
+	verifyEmailTTL   time.Duration
+	resetPasswordTTL time.Duration
+	resetPasswordURL string
+	requireVerified  bool
+}
+
+// NewAccountService creates a new account service. Verification links point at
+// publicBaseURL and reset links at the frontend page cfg.PasswordResetURL; without them
+// the respective emails are not sent. cfg.RequireVerifiedEmail blocks unverified users
+// from AI endpoints.
+func NewAccountService(db *gorm.DB, userService *UserService, authService *AuthService, cfg config.AccountConfig, mail config.MailConfig, publicBaseURL string) *AccountService {
+	if publicBaseURL == "" {
+		slog.Warn("server.public_base_url is not configured, verification emails are disabled")
+	}
+	if cfg.PasswordResetURL == "" {
+		slog.Warn("account.password_reset_url is not configured, password reset is disabled")
+	}
+	return &AccountService{
+		db:               db,
+		userService:      userService,
+		authService:      authService,
+		mailer:           newMailer(mail),
+		publicBaseURL:    strings.TrimRight(publicBaseURL, "/"),
+		verifyEmailTTL:   cfg.VerifyEmailTTL,
+		resetPasswordTTL: cfg.ResetPasswordTTL,
+		resetPasswordURL: cfg.PasswordResetURL,
+		requireVerified:  cfg.RequireVerifiedEmail,
+	}
+}
+
+// newMailer creates the configured mail backend: "smtp" or "log", which only logs messages
+func newMailer(cfg config.MailConfig) mailer.Mailer {
+	if cfg.Mailer == "smtp" {
+		return &mailer.SMTPMailer{
+			Host:     cfg.SMTPHost,
+			Port:     strconv.Itoa(cfg.SMTPPort),
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+			From:     cfg.From,
+		}
+	}
+	return &mailer.LogMailer{}
+}
+
+// RequireVerified reports whether unverified users are blocked from AI endpoints
+func (as *AccountService) RequireVerified() bool {
+	return as.requireVerified
+}
+
+// SendVerification emails the user a link that confirms their address
+func (as *AccountService) SendVerification(user models.User) error {
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+	if as.publicBaseURL == "" {
+		return ErrEmailLinksDisabled
+	}
+
+	token, err := as.issueToken(user, models.TokenPurposeVerifyEmail, as.verifyEmailTTL)
+	if err != nil {
+		return err
+	}
+
+	link := as.publicBaseURL + "/auth/verify-email?token=" + url.QueryEscape(token)
+	return as.send("verify_email", user, link, as.verifyEmailTTL)
+}
+
+// VerifyEmail consumes a verification token and marks the address it was sent to as verified
+func (as *AccountService) VerifyEmail(token string) (models.User, error) {
+	stored, err := as.consumeToken(token, models.TokenPurposeVerifyEmail)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if err := as.markVerified(stored); err != nil {
+		return models.User{}, err
+	}
+	// A verified admin email proves the user is the configured admin
+	if err := as.userService.promoteAdmins(as.db.Where("id = ?", stored.UserID)); err != nil {
+		return models.User{}, err
+	}
+	return as.userService.GetUser(stored.UserID)
+}
+
+// RequestPasswordReset emails a reset link if the address belongs to a user. It does
+// not report whether the address exists so it cannot be used to discover accounts.
+func (as *AccountService) RequestPasswordReset(email string) error {
+	if as.resetPasswordURL == "" {
+		return ErrPasswordResetDisabled
+	}
+
+	var user models.User
+	if err := as.db.Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := as.issueToken(user, models.TokenPurposeResetPassword, as.resetPasswordTTL)
+	if err != nil {
+		return err
+	}
+
+	link, err := tokenLink(as.resetPasswordURL, token)
+	if err != nil {
+		return err
+	}
+	return as.send("reset_password", user, link, as.resetPasswordTTL)
+}
+
+// ResetPassword consumes a reset token and sets a new password. Receiving the email
+// also proves ownership of the address it was sent to, so that address is marked as
+// verified.
+func (as *AccountService) ResetPassword(token string, password string) error {
+	stored, err := as.consumeToken(token, models.TokenPurposeResetPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := as.authService.SetPassword(stored.UserID, password); err != nil {
+		return err
+	}
+	return as.markVerified(stored)
+}
+
+// markVerified marks the address a token was sent to as verified, provided it is still
+// the user's address
+func (as *AccountService) markVerified(stored models.UserToken) error {
+	return as.db.Model(&models.User{}).
+		Where("id = ? AND LOWER(email) = ? AND email_verified_at IS NULL", stored.UserID, strings.ToLower(stored.Email)).
+		Update("email_verified_at", time.Now()).Error
+}
+
+// issueToken creates a new token for the user's current address and invalidates earlier
+// unused tokens for the same purpose
+func (as *AccountService) issueToken(user models.User, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	err = as.db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			Email:     user.Email,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeToken marks a valid token as used and returns it. A token sent to an address
+// the user no longer has is invalid.
+func (as *AccountService) consumeToken(token string, purpose string) (models.UserToken, error) {
+	var stored models.UserToken
+	if err := as.db.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.UserToken{}, ErrInvalidToken
+		}
+		return models.UserToken{}, err
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return models.UserToken{}, ErrInvalidToken
+	}
+
+	user, err := as.userService.GetUser(stored.UserID)
+	if errors.Is(err, ErrUserNotFound) {
+		return models.UserToken{}, ErrInvalidToken
+	}
+	if err != nil {
+		return models.UserToken{}, err
+	}
+	if !strings.EqualFold(user.Email, stored.Email) {
+		return models.UserToken{}, ErrInvalidToken
+	}
+
+	// Only one request can flip used_at, so concurrent use of the same token fails
+	result := as.db.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", stored.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return models.UserToken{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.UserToken{}, ErrInvalidToken
+	}
+	return stored, nil
+}
+
+func (as *AccountService) send(template string, user models.User, link string, ttl time.Duration) error {
+	msg, err := mailer.Render(template, user.Email, map[string]any{
+		"Name":      user.Name,
+		"Link":      link,
+		"ExpiresIn": formatTTL(ttl),
+	})
+	if err != nil {
+		return err
+	}
+	return as.mailer.Send(msg)
+}
+
+// formatTTL renders a token lifetime for humans, e.g. "24 hours" or "30 minutes"
+func formatTTL(ttl time.Duration) string {
+	if ttl%time.Hour == 0 {
+		if hours := int(ttl.Hours()); hours != 1 {
+			return strconv.Itoa(hours) + " hours"
+		}
+		return "1 hour"
+	}
+	return strconv.Itoa(int(ttl.Minutes())) + " minutes"
+}
+
+// tokenLink returns the page URL with token set as its token query parameter, keeping
+// any query and fragment the page already has
+func tokenLink(page string, token string) (string, error) {
+	link, err := url.Parse(page)
+	if err != nil {
+		return "", fmt.Errorf("invalid link URL: %w", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
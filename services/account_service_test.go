@@ -0,0 +1,114 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+)
+
+func newTestAccountService(t *testing.T) (*AccountService, *UserService) {
+	t.Helper()
+
+	db := newTestDB(t)
+	authConfig := config.AuthConfig{
+		JWTSecret:       "test-jwt-secret",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		AdminEmails:     []string{"boss@example.com"},
+	}
+	userService := NewUserService(db, authConfig)
+	authService := NewAuthService(db, userService, authConfig)
+	accounts := NewAccountService(db, userService, authService, config.AccountConfig{
+		VerifyEmailTTL:   time.Hour,
+		ResetPasswordTTL: time.Hour,
+		PasswordResetURL: "https://app.example.com/reset",
+	}, config.MailConfig{Mailer: "log"}, "https://api.example.com")
+	return accounts, userService
+}
+
+func TestAccountServiceTokensAfterEmailChange(t *testing.T) {
+	tests := []struct {
+		name    string
+		purpose string
+		// newEmail, when set, replaces the user's address after the token was sent
+		newEmail     string
+		wantErr      error
+		wantVerified bool
+	}{
+		{name: "verification", purpose: models.TokenPurposeVerifyEmail, wantVerified: true},
+		{name: "password reset", purpose: models.TokenPurposeResetPassword, wantVerified: true},
+		{name: "verification after an email change", purpose: models.TokenPurposeVerifyEmail, newEmail: "boss@example.com", wantErr: ErrInvalidToken},
+		{name: "password reset after an email change", purpose: models.TokenPurposeResetPassword, newEmail: "boss@example.com", wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			accounts, users := newTestAccountService(t)
+			user, err := users.CreateUser(models.User{Name: "Member", Email: "member@example.com"})
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			token, err := accounts.issueToken(user, tt.purpose, time.Hour)
+			if err != nil {
+				t.Fatalf("issueToken: %v", err)
+			}
+			if tt.newEmail != "" {
+				if _, err := users.UpdateUser(user.ID, models.UpdateUserRequest{Email: &tt.newEmail}); err != nil {
+					t.Fatalf("UpdateUser: %v", err)
+				}
+			}
+
+			if tt.purpose == models.TokenPurposeVerifyEmail {
+				_, err = accounts.VerifyEmail(token)
+			} else {
+				err = accounts.ResetPassword(token, "new password")
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+
+			got, err := users.GetUser(user.ID)
+			if err != nil {
+				t.Fatalf("GetUser: %v", err)
+			}
+			if verified := got.EmailVerifiedAt != nil; verified != tt.wantVerified {
+				t.Errorf("verified = %v, want %v", verified, tt.wantVerified)
+			}
+			// Promotion happens for verified admin emails only, also at startup
+			if err := users.PromoteAdmins(); err != nil {
+				t.Fatalf("PromoteAdmins: %v", err)
+			}
+			if got, _ := users.GetUser(user.ID); got.Role != models.RoleMember {
+				t.Errorf("role = %q, want %q", got.Role, models.RoleMember)
+			}
+		})
+	}
+}
+
+func TestTokenLink(t *testing.T) {
+	tests := []struct {
+		page string
+		want string
+	}{
+		{page: "https://app.example.com/reset", want: "https://app.example.com/reset?token=a%2Bb%2Fc"},
+		{page: "https://app.example.com/reset?lang=de", want: "https://app.example.com/reset?lang=de&token=a%2Bb%2Fc"},
+		{page: "https://app.example.com/#/reset", want: "https://app.example.com/?token=a%2Bb%2Fc#/reset"},
+		{page: "https://app.example.com/reset?token=stale", want: "https://app.example.com/reset?token=a%2Bb%2Fc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.page, func(t *testing.T) {
+			got, err := tokenLink(tt.page, "a+b/c")
+			if err != nil {
+				t.Fatalf("tokenLink: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("tokenLink = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
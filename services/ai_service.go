@@ -1,84 +1,222 @@
 package services
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
 
+	"sample-api/config"
 	"sample-api/services/providers"
 )
 
 // AIService handles communication with AI platforms
 type AIService struct {
-	provider  providers.AIProvider
-	apiKey    string
-	modelName string
+	providerType string
+	model        string
+	// provider is used for token estimates; requests get a client for the key they use
+	provider providers.AIProvider
+	// apiKey is set when the caller brings its own credentials; otherwise the server's
+	// keys for the provider are used
+	apiKey             string
+	keyring            *Keyring
+	googleModel        string
+	summaryConcurrency int
+	// outputLanguage, when set, is the language analyses and summaries are written in
+	outputLanguage string
+	// ctx is the context of the request the service is used for
+	ctx context.Context
 }
 
-// NewAIService creates a new AI service with the specified provider
-func NewAIService(providerType string) *AIService {
-	apiKey := os.Getenv("AI_API_KEY")
-	googleModel := os.Getenv("GOOGLE_MODEL")
-	if apiKey == "" {
-		log.Println("Warning: AI_API_KEY environment variable not set")
+// NewAIService creates a new AI service for the configured default provider using the
+// server's keys
+func NewAIService(cfg config.AIConfig) *AIService {
+	base := &AIService{
+		ctx:                context.Background(),
+		keyring:            NewKeyring(cfg),
+		googleModel:        cfg.GoogleModel,
+		summaryConcurrency: cfg.SummaryConcurrency,
 	}
+	return base.scoped(cfg.Provider, "", "")
+}
+
+// IsKnownProvider reports whether providerType names a supported AI provider
+func IsKnownProvider(providerType string) bool {
+	return slices.Contains(config.Providers, providerType)
+}
+
+// TranscriptionProvider is the provider audio is transcribed with, whatever provider is
+// used for chat: it is the only one with a speech-to-text API
+const TranscriptionProvider = "openai"
+
+// modelPatterns are the model names each provider accepts. Models are chosen by clients
+// and end up in request URLs and metric labels, so anything else is refused up front.
+var modelPatterns = map[string]*regexp.Regexp{
+	"openai":    regexp.MustCompile(`^(gpt-|chatgpt-|o[1-9]|ft:)[A-Za-z0-9._:-]*$`),
+	"anthropic": regexp.MustCompile(`^claude-[a-z0-9.-]+$`),
+	"google":    regexp.MustCompile(`^(gemini|gemma)-[a-z0-9.-]+$`),
+}
 
-	var provider providers.AIProvider
+// maxModelLength bounds model names; no provider uses names anywhere near this long
+const maxModelLength = 100
 
+// IsKnownModel reports whether model is a plausible model name for providerType. An
+// empty model is accepted and selects the provider's default.
+func IsKnownModel(providerType string, model string) bool {
+	if model == "" {
+		return true
+	}
+	pattern, ok := modelPatterns[providerType]
+	return ok && len(model) <= maxModelLength && pattern.MatchString(model)
+}
+
+// newProvider builds a provider client; an empty model selects the provider's default
+func newProvider(providerType string, apiKey string, model string) providers.AIProvider {
 	switch providerType {
-	case "openai":
-		provider = &providers.OpenAIProvider{
-			APIKey:    apiKey,
-			ModelName: "gpt-3.5-turbo",
-		}
 	case "google":
-		provider = &providers.GoogleAIProvider{
+		return &providers.GoogleAIProvider{
 			APIKey:    apiKey,
-			ModelName: googleModel,
+			ModelName: model,
 		}
 	case "anthropic":
-		provider = &providers.AnthropicProvider{
+		if model == "" {
+			model = "claude-3-sonnet-20240229"
+		}
+		return &providers.AnthropicProvider{
 			APIKey:    apiKey,
-			ModelName: "claude-3-sonnet-20240229",
+			ModelName: model,
 		}
 	default:
-		log.Printf("Unknown provider: %s, defaulting to OpenAI", providerType)
-		provider = &providers.OpenAIProvider{
-			APIKey:    apiKey,
-			ModelName: "gpt-3.5-turbo",
+		if model == "" {
+			model = "gpt-3.5-turbo"
+		}
+		return &providers.OpenAIProvider{
+			APIKey:             apiKey,
+			ModelName:          model,
+			TranscriptionModel: "whisper-1",
 		}
 	}
+}
+
+// ProviderName returns the name of the provider requests are sent to
+func (as *AIService) ProviderName() string {
+	return as.providerType
+}
+
+// HasServerKeys reports whether the server has API keys for providerType
+func (as *AIService) HasServerKeys(providerType string) bool {
+	return as.keyring.Has(providerType)
+}
+
+// ReloadKeys replaces the server's API keys for this service and every copy of it
+func (as *AIService) ReloadKeys(cfg config.AIConfig) {
+	as.keyring.Reload(cfg)
+}
+
+// WithProvider returns a copy of the service that sends requests to providerType using
+// the server's keys
+func (as *AIService) WithProvider(providerType string, model string) *AIService {
+	return as.scoped(providerType, "", model)
+}
+
+// WithCredentials returns a copy of the service that sends requests to providerType
+// using apiKey, for callers that bring their own credentials
+func (as *AIService) WithCredentials(providerType string, apiKey string, model string) *AIService {
+	return as.scoped(providerType, apiKey, model)
+}
+
+// WithModel returns a copy of the service that uses a different model of the same provider
+func (as *AIService) WithModel(model string) *AIService {
+	return as.scoped(as.providerType, as.apiKey, model)
+}
+
+func (as *AIService) scoped(providerType string, apiKey string, model string) *AIService {
+	// The Google model has always been the only configurable default model
+	if model == "" && providerType == "google" {
+		model = as.googleModel
+	}
+
+	scoped := *as
+	scoped.providerType = providerType
+	scoped.model = model
+	scoped.apiKey = apiKey
+	scoped.provider = newProvider(providerType, apiKey, model)
+	return &scoped
+}
 
-	return &AIService{
-		provider:  provider,
-		apiKey:    apiKey,
-		modelName: providerType,
+// call runs fn with a client for the caller's key, or with the server's keys in turn
+// until one is not rate limited or rejected
+func (as *AIService) call(fn func(provider providers.AIProvider) error) error {
+	var err error
+	if as.apiKey != "" {
+		err = fn(as.provider)
+	} else {
+		err = as.keyring.Do(as.ctx, as.providerType, func(apiKey string) error {
+			return fn(newProvider(as.providerType, apiKey, as.model))
+		})
 	}
+	if err != nil {
+		slog.WarnContext(as.ctx, "AI provider call failed", "provider", as.providerType, "model", as.model, "error", err)
+	}
+	return err
+}
+
+// WithContext returns a copy of the service whose provider calls belong to ctx: they
+// are cancelled with it and their log lines carry its request ID
+func (as *AIService) WithContext(ctx context.Context) *AIService {
+	scoped := *as
+	scoped.ctx = ctx
+	return &scoped
+}
+
+// WithLanguage returns a copy of the service that writes analyses and summaries in language
+func (as *AIService) WithLanguage(language string) *AIService {
+	scoped := *as
+	scoped.outputLanguage = language
+	return &scoped
 }
 
 // PromptAI sends a prompt to the AI platform and returns the response
 func (as *AIService) PromptAI(prompt string) (string, error) {
-	if as.apiKey == "" {
-		return "", fmt.Errorf("AI API key not configured")
-	}
-
-	return as.provider.PromptAI(prompt)
+	var response string
+	err := as.call(func(provider providers.AIProvider) (err error) {
+		response, err = provider.PromptAI(as.ctx, prompt)
+		return err
+	})
+	return response, err
 }
 
-// AnalyzeYouTubeContent uses AI to analyze YouTube audio/content
-func (as *AIService) AnalyzeYouTubeContent(content string) (string, error) {
-	prompt := fmt.Sprintf("Analyze the following YouTube content and provide a summary:\n\n%s", content)
+// AnalyzeYouTubeContent uses AI to analyze YouTube audio/content. analysisTypes selects
+// what to provide (e.g. "sentiment", "keywords"); by default it is a summary.
+func (as *AIService) AnalyzeYouTubeContent(content string, analysisTypes []string) (string, error) {
+	wanted := "a summary"
+	if len(analysisTypes) > 0 {
+		wanted = "the following: " + strings.ReplaceAll(strings.Join(analysisTypes, ", "), "_", " ")
+	}
+	prompt := fmt.Sprintf("Analyze the following YouTube content and provide %s.%s\n\n%s", wanted, as.languageInstruction(), content)
 	return as.PromptAI(prompt)
 }
 
-// TranscribeAudio uses AI to transcribe audio content
-func (as *AIService) TranscribeAudio(audioPath string) (string, error) {
-	prompt := fmt.Sprintf("Transcribe the audio file at: %s", audioPath)
-	return as.PromptAI(prompt)
+// languageInstruction asks the model to answer in the configured output language, if any
+func (as *AIService) languageInstruction() string {
+	if as.outputLanguage == "" {
+		return ""
+	}
+	return fmt.Sprintf(" Write your answer in the language %q.", as.outputLanguage)
 }
 
-// GenerateSummary generates a summary of provided text using AI
-func (as *AIService) GenerateSummary(text string, length string) (string, error) {
-	prompt := fmt.Sprintf("Generate a %s summary of the following text:\n\n%s", length, text)
-	return as.PromptAI(prompt)
+// TranscribeAudio uses the provider's speech-to-text API to transcribe a single audio file
+func (as *AIService) TranscribeAudio(audioPath string, language string) (*providers.Transcription, error) {
+	if _, ok := as.provider.(providers.Transcriber); !ok {
+		return nil, fmt.Errorf("transcription is not supported by provider: %s", as.providerType)
+	}
+
+	var transcription *providers.Transcription
+	err := as.call(func(provider providers.AIProvider) (err error) {
+		transcription, err = provider.(providers.Transcriber).TranscribeAudio(as.ctx, audioPath, language)
+		return err
+	})
+	return transcription, err
 }
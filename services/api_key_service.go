@@ -0,0 +1,139 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"sample-api/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// APIKeyPrefix marks API keys so they can be told apart from JWT access tokens
+	APIKeyPrefix = "sk_"
+
+	apiKeyDisplayLength = len(APIKeyPrefix) + 8
+)
+
+// API key scopes limit what a machine client may call
+const (
+	ScopeAI         = "ai"
+	ScopeAudio      = "audio"
+	ScopeOrgsRead   = "orgs:read"
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+type APIKeyService struct {
+	db          *gorm.DB
+	userService *UserService
+}
+
+func NewAPIKeyService(db *gorm.DB, userService *UserService) *APIKeyService {
+	return &APIKeyService{
+		db:          db,
+		userService: userService,
+	}
+}
+
+// Create generates a new key for the user and returns it with its plaintext value
+func (s *APIKeyService) Create(userID uint, label string, scopes []string) (models.APIKey, string, error) {
+	secret, err := randomToken()
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	plaintext := APIKeyPrefix + secret
+
+	key := models.APIKey{
+		UserID:  userID,
+		Label:   label,
+		Prefix:  plaintext[:apiKeyDisplayLength],
+		KeyHash: hashToken(plaintext),
+		Scopes:  scopes,
+	}
+	if err := s.db.Create(&key).Error; err != nil {
+		return models.APIKey{}, "", err
+	}
+	return key, plaintext, nil
+}
+
+// List returns all keys of a user, including revoked ones
+func (s *APIKeyService) List(userID uint) ([]models.APIKey, error) {
+	keys := []models.APIKey{}
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// UpdateLabel renames one of the user's keys
+func (s *APIKeyService) UpdateLabel(userID uint, id uint, label string) (models.APIKey, error) {
+	key, err := s.get(userID, id)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if err := s.db.Model(&key).Update("label", label).Error; err != nil {
+		return models.APIKey{}, err
+	}
+	return key, nil
+}
+
+// Revoke permanently disables one of the user's keys
+func (s *APIKeyService) Revoke(userID uint, id uint) error {
+	key, err := s.get(userID, id)
+	if err != nil {
+		return err
+	}
+	if key.RevokedAt != nil {
+		return nil
+	}
+	return s.db.Model(&key).Update("revoked_at", time.Now()).Error
+}
+
+// Authenticate resolves a plaintext key to its owner and records when and from where it was used
+func (s *APIKeyService) Authenticate(plaintext string, ip string) (models.User, models.APIKey, error) {
+	if !strings.HasPrefix(plaintext, APIKeyPrefix) {
+		return models.User{}, models.APIKey{}, ErrInvalidToken
+	}
+
+	var key models.APIKey
+	if err := s.db.Where("key_hash = ? AND revoked_at IS NULL", hashToken(plaintext)).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.User{}, models.APIKey{}, ErrInvalidToken
+		}
+		return models.User{}, models.APIKey{}, err
+	}
+
+	user, err := s.userService.GetUser(key.UserID)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return models.User{}, models.APIKey{}, ErrInvalidToken
+		}
+		return models.User{}, models.APIKey{}, err
+	}
+
+	now := time.Now()
+	if err := s.db.Model(&key).Updates(map[string]interface{}{
+		"last_used_at": now,
+		"last_used_ip": ip,
+	}).Error; err != nil {
+		return models.User{}, models.APIKey{}, err
+	}
+
+	return user, key, nil
+}
+
+func (s *APIKeyService) get(userID uint, id uint) (models.APIKey, error) {
+	var key models.APIKey
+	if err := s.db.Where("user_id = ?", userID).First(&key, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.APIKey{}, ErrAPIKeyNotFound
+		}
+		return models.APIKey{}, err
+	}
+	return key, nil
+}
@@ -0,0 +1,333 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"sample-api/models"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// EBU R128 targets used for podcast-style loudness normalization
+	loudnessTarget     = -16.0
+	truePeakTarget     = -1.5
+	loudnessRangeLimit = 11.0
+
+	defaultSilenceThreshold = -35.0
+	defaultMinSilence       = 0.5
+	trimSilenceThreshold    = -50.0
+
+	// maxAudioChunks bounds how many files a single request may split audio into
+	maxAudioChunks = 500
+)
+
+var (
+	silenceStartPattern = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceEndPattern   = regexp.MustCompile(`silence_end: (-?[0-9.]+)`)
+)
+
+// AudioSegment is a slice of an audio file written to its own file
+type AudioSegment struct {
+	Path     string
+	Start    float64
+	Duration float64
+}
+
+// ProcessedAudio is the result of running post-processing on an extracted file
+type ProcessedAudio struct {
+	Path     string
+	Duration float64
+	Chunks   []AudioSegment
+}
+
+// AudioService post-processes audio files with ffmpeg
+type AudioService struct{}
+
+// NewAudioService creates a new audio service
+func NewAudioService() *AudioService {
+	return &AudioService{}
+}
+
+// Process applies the requested post-processing steps to the audio file at path.
+// The input and any intermediate files are removed once they have been replaced;
+// the returned paths live next to the input file. On error, every file Process wrote
+// is removed and the input, if it still exists, is left to the caller.
+func (as *AudioService) Process(path string, opts models.AudioProcessingOptions) (result *ProcessedAudio, err error) {
+	current := path
+	defer func() {
+		if err != nil && current != path {
+			os.Remove(current)
+		}
+	}()
+	if opts.Normalize {
+		normalized, err := as.Normalize(current)
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(current)
+		current = normalized
+	}
+
+	if opts.TrimSilence {
+		trimmed, err := as.TrimSilence(current)
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(current)
+		current = trimmed
+	}
+
+	duration, err := as.Duration(current)
+	if err != nil {
+		return nil, err
+	}
+
+	result = &ProcessedAudio{
+		Path:     current,
+		Duration: duration,
+	}
+
+	if opts.Chunk != nil {
+		var plan []AudioSegment
+		switch opts.Chunk.Mode {
+		case "fixed":
+			plan, err = fixedChunkPlan(duration, opts.Chunk.Length)
+			if err != nil {
+				return nil, err
+			}
+		case "silence":
+			threshold := opts.Chunk.SilenceThreshold
+			if threshold == 0 {
+				threshold = defaultSilenceThreshold
+			}
+			minSilence := opts.Chunk.MinSilence
+			if minSilence == 0 {
+				minSilence = defaultMinSilence
+			}
+			silences, err := as.DetectSilences(current, threshold, minSilence)
+			if err != nil {
+				return nil, err
+			}
+			plan = silenceChunkPlan(duration, silences, opts.Chunk.Length)
+			if len(plan) > maxAudioChunks {
+				return nil, fmt.Errorf("audio would be split into %d chunks, at most %d are allowed", len(plan), maxAudioChunks)
+			}
+		default:
+			return nil, fmt.Errorf("unknown chunk mode: %s", opts.Chunk.Mode)
+		}
+
+		for _, segment := range plan {
+			chunkPath, err := as.Cut(current, segment.Start, segment.Duration)
+			if err != nil {
+				for _, chunk := range result.Chunks {
+					os.Remove(chunk.Path)
+				}
+				return nil, err
+			}
+			segment.Path = chunkPath
+			result.Chunks = append(result.Chunks, segment)
+		}
+	}
+
+	return result, nil
+}
+
+// Normalize applies two-pass EBU R128 loudness normalization
+func (as *AudioService) Normalize(path string) (string, error) {
+	filter := fmt.Sprintf("loudnorm=I=%.1f:TP=%.1f:LRA=%.1f", loudnessTarget, truePeakTarget, loudnessRangeLimit)
+
+	// First pass measures the input loudness
+	output, err := runFFmpeg("-i", path, "-af", filter+":print_format=json", "-f", "null", "-")
+	if err != nil {
+		return "", err
+	}
+
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start == -1 || end < start {
+		return "", fmt.Errorf("failed to read loudness measurement from ffmpeg output")
+	}
+
+	var measured struct {
+		InputI       string `json:"input_i"`
+		InputTP      string `json:"input_tp"`
+		InputLRA     string `json:"input_lra"`
+		InputThresh  string `json:"input_thresh"`
+		TargetOffset string `json:"target_offset"`
+	}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &measured); err != nil {
+		return "", fmt.Errorf("failed to parse loudness measurement: %w", err)
+	}
+
+	// Second pass applies a linear gain based on the measurement
+	filter = fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true",
+		filter, measured.InputI, measured.InputTP, measured.InputLRA, measured.InputThresh, measured.TargetOffset)
+
+	outputPath := siblingPath(path, ".mp3")
+	if _, err := runFFmpeg("-i", path, "-af", filter, "-ar", "44100", "-b:a", "192k", outputPath); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// TrimSilence removes leading and trailing silence
+func (as *AudioService) TrimSilence(path string) (string, error) {
+	trim := fmt.Sprintf("silenceremove=start_periods=1:start_duration=0:start_threshold=%.0fdB:detection=peak", trimSilenceThreshold)
+	// Trailing silence is trimmed by reversing, trimming the start again and reversing back
+	filter := strings.Join([]string{trim, "areverse", trim, "areverse"}, ",")
+
+	outputPath := siblingPath(path, ".mp3")
+	if _, err := runFFmpeg("-i", path, "-af", filter, "-b:a", "192k", outputPath); err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// DetectSilences returns the [start, end] ranges in seconds where the audio stays below threshold dBFS
+func (as *AudioService) DetectSilences(path string, threshold float64, minSilence float64) ([][2]float64, error) {
+	filter := fmt.Sprintf("silencedetect=noise=%.1fdB:d=%.2f", threshold, minSilence)
+	output, err := runFFmpeg("-i", path, "-af", filter, "-f", "null", "-")
+	if err != nil {
+		return nil, err
+	}
+
+	var silences [][2]float64
+	start := -1.0
+	for _, line := range strings.Split(output, "\n") {
+		if m := silenceStartPattern.FindStringSubmatch(line); m != nil {
+			start, _ = strconv.ParseFloat(m[1], 64)
+			start = math.Max(start, 0)
+		} else if m := silenceEndPattern.FindStringSubmatch(line); m != nil && start >= 0 {
+			end, _ := strconv.ParseFloat(m[1], 64)
+			silences = append(silences, [2]float64{start, end})
+			start = -1
+		}
+	}
+	return silences, nil
+}
+
+// Cut copies duration seconds of audio starting at start into a new file
+func (as *AudioService) Cut(path string, start float64, duration float64) (string, error) {
+	outputPath := siblingPath(path, filepath.Ext(path))
+	_, err := runFFmpeg(
+		"-ss", formatSeconds(start),
+		"-i", path,
+		"-t", formatSeconds(duration),
+		"-c", "copy",
+		outputPath,
+	)
+	if err != nil {
+		return "", err
+	}
+	return outputPath, nil
+}
+
+// Duration returns the length of the audio file in seconds
+func (as *AudioService) Duration(path string) (float64, error) {
+	cmd := exec.Command("ffprobe",
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1",
+		path,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %v, output: %s", err, string(output))
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse duration: %w", err)
+	}
+	return duration, nil
+}
+
+// fixedChunkPlan splits duration into consecutive segments of the given length
+func fixedChunkPlan(duration float64, length float64) ([]AudioSegment, error) {
+	if !(length > 0) {
+		return nil, fmt.Errorf("chunk length must be greater than zero for fixed chunking")
+	}
+	if count := math.Ceil(duration / length); count > maxAudioChunks {
+		return nil, fmt.Errorf("audio would be split into %.0f chunks, at most %d are allowed", count, maxAudioChunks)
+	}
+
+	var plan []AudioSegment
+	for start := 0.0; start < duration; start += length {
+		plan = append(plan, AudioSegment{
+			Start:    start,
+			Duration: math.Min(length, duration-start),
+		})
+	}
+	return plan, nil
+}
+
+// silenceChunkPlan splits at the middle of detected silences. When maxLength is set,
+// neighbouring pieces are merged up to that length and pieces without any silence
+// are cut hard at maxLength.
+func silenceChunkPlan(duration float64, silences [][2]float64, maxLength float64) []AudioSegment {
+	var cuts []float64
+	for _, silence := range silences {
+		mid := (silence[0] + silence[1]) / 2
+		if mid > 0 && mid < duration {
+			cuts = append(cuts, mid)
+		}
+	}
+	cuts = append(cuts, duration)
+
+	var plan []AudioSegment
+	start := 0.0
+	for i, cut := range cuts {
+		if maxLength > 0 {
+			// Keep growing the chunk while the next cut still fits
+			if i+1 < len(cuts) && cuts[i+1]-start <= maxLength {
+				continue
+			}
+			for cut-start > maxLength {
+				plan = append(plan, AudioSegment{Start: start, Duration: maxLength})
+				start += maxLength
+			}
+		}
+		if cut > start {
+			plan = append(plan, AudioSegment{Start: start, Duration: cut - start})
+			start = cut
+		}
+	}
+	return plan
+}
+
+// runFFmpeg runs ffmpeg with the given arguments and returns its combined output
+func runFFmpeg(args ...string) (string, error) {
+	args = append([]string{"-hide_banner", "-nostdin", "-y"}, args...)
+	cmd := exec.Command("ffmpeg", args...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ffmpeg failed: %v, output: %s", err, lastLines(string(output), 5))
+	}
+	return string(output), nil
+}
+
+// siblingPath returns a new unique file path in the same directory as path
+func siblingPath(path string, ext string) string {
+	return filepath.Join(filepath.Dir(path), uuid.New().String()+ext)
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
+
+func lastLines(s string, n int) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
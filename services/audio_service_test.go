@@ -0,0 +1,59 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFixedChunkPlan(t *testing.T) {
+	tests := []struct {
+		name      string
+		duration  float64
+		length    float64
+		want      []AudioSegment
+		wantCount int
+		wantErr   bool
+	}{
+		{
+			name:     "shorter than one chunk",
+			duration: 30, length: 60,
+			want: []AudioSegment{{Start: 0, Duration: 30}},
+		},
+		{
+			name:     "last chunk is shorter",
+			duration: 150, length: 60,
+			want: []AudioSegment{{Start: 0, Duration: 60}, {Start: 60, Duration: 60}, {Start: 120, Duration: 30}},
+		},
+		{
+			name:     "even split",
+			duration: 120, length: 60,
+			want: []AudioSegment{{Start: 0, Duration: 60}, {Start: 60, Duration: 60}},
+		},
+		{name: "at the chunk limit", duration: maxAudioChunks, length: 1, wantCount: maxAudioChunks},
+		{name: "over the chunk limit", duration: maxAudioChunks + 1, length: 1, wantErr: true},
+		{name: "tiny chunks of a long file", duration: 3600, length: 0.001, wantErr: true},
+		{name: "zero length", duration: 120, length: 0, wantErr: true},
+		{name: "negative length", duration: 120, length: -60, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fixedChunkPlan(tt.duration, tt.length)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("fixedChunkPlan returned %d chunks, want an error", len(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("fixedChunkPlan: %v", err)
+			}
+			if tt.want != nil && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("fixedChunkPlan = %v, want %v", got, tt.want)
+			}
+			if tt.wantCount != 0 && len(got) != tt.wantCount {
+				t.Fatalf("fixedChunkPlan returned %d chunks, want %d", len(got), tt.wantCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,283 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const tokenIssuer = "sample-api"
+
+var (
+	ErrInvalidCredentials = errors.New("invalid email or password")
+	ErrInvalidToken       = errors.New("invalid or expired token")
+)
+
+// AuthService handles password authentication and issues JWT access tokens together
+// with rotating refresh tokens that are stored server-side so they can be revoked
+type AuthService struct {
+	db              *gorm.DB
+	userService     *UserService
+	secret          []byte
+	accessTokenTTL  time.Duration
+	refreshTokenTTL time.Duration
+	dummyHash       []byte
+}
+
+// NewAuthService creates a new auth service. Access tokens are signed with the configured
+// JWT secret, or a random one when it is not set.
+func NewAuthService(db *gorm.DB, userService *UserService, cfg config.AuthConfig) *AuthService {
+	// Compared against when a login email is unknown so both paths take as long
+	dummyHash, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+	return &AuthService{
+		db:              db,
+		userService:     userService,
+		secret:          signingSecret("auth.jwt_secret", cfg.JWTSecret),
+		accessTokenTTL:  cfg.AccessTokenTTL,
+		refreshTokenTTL: cfg.RefreshTokenTTL,
+		dummyHash:       dummyHash,
+	}
+}
+
+// Register creates a user with a password and logs them in
+func (as *AuthService) Register(req models.RegisterRequest) (*models.TokenResponse, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	user, err := as.userService.CreateUser(models.User{
+		Name:         req.Name,
+		Email:        req.Email,
+		PasswordHash: string(hash),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return as.issueTokens(user, uuid.New().String())
+}
+
+// Login verifies an email and password and issues a new token pair
+func (as *AuthService) Login(email string, password string) (*models.TokenResponse, error) {
+	var user models.User
+	err := as.db.Where("LOWER(email) = ?", models.NormalizeEmail(email)).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if err != nil || user.PasswordHash == "" {
+		bcrypt.CompareHashAndPassword(as.dummyHash, []byte(password))
+		return nil, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)) != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	return as.issueTokens(user, uuid.New().String())
+}
+
+// LoginUser issues a new token pair for a user who was authenticated some other way,
+// such as single sign-on
+func (as *AuthService) LoginUser(user models.User) (*models.TokenResponse, error) {
+	return as.issueTokens(user, uuid.New().String())
+}
+
+// Refresh rotates a refresh token: the presented token is revoked and a new pair is
+// issued. Presenting an already rotated token revokes every token of that login.
+func (as *AuthService) Refresh(refreshToken string) (*models.TokenResponse, error) {
+	var (
+		response       *models.TokenResponse
+		reusedFamilyID string
+	)
+	err := as.db.Transaction(func(tx *gorm.DB) error {
+		var stored models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		if stored.RevokedAt != nil {
+			reusedFamilyID = stored.FamilyID
+			return ErrInvalidToken
+		}
+		if time.Now().After(stored.ExpiresAt) {
+			return ErrInvalidToken
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", stored.ID).
+			Update("revoked_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Lost a race with a concurrent refresh of the same token
+			return ErrInvalidToken
+		}
+
+		var user models.User
+		if err := tx.First(&user, stored.UserID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidToken
+			}
+			return err
+		}
+
+		var err error
+		response, err = as.issueTokensWith(tx, user, stored.FamilyID)
+		return err
+	})
+
+	// A rotated token was replayed, so the whole chain may be compromised. This runs
+	// after the transaction because returning an error rolls the transaction back.
+	if reusedFamilyID != "" {
+		if err := revokeFamily(as.db, reusedFamilyID); err != nil {
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Logout revokes the refresh token and every other token from the same login
+func (as *AuthService) Logout(refreshToken string) error {
+	var stored models.RefreshToken
+	if err := as.db.Where("token_hash = ?", hashToken(refreshToken)).First(&stored).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidToken
+		}
+		return err
+	}
+	return revokeFamily(as.db, stored.FamilyID)
+}
+
+// SetPassword replaces a user's password and signs them out everywhere
+func (as *AuthService) SetPassword(userID uint, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return as.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("password_hash", string(hash)).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// Authenticate validates an access token and returns the user it was issued to
+func (as *AuthService) Authenticate(accessToken string) (models.User, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(accessToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return as.secret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return models.User{}, ErrInvalidToken
+	}
+
+	id, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return models.User{}, ErrInvalidToken
+	}
+
+	user, err := as.userService.GetUser(uint(id))
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return models.User{}, ErrInvalidToken
+		}
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+func (as *AuthService) issueTokens(user models.User, familyID string) (*models.TokenResponse, error) {
+	return as.issueTokensWith(as.db, user, familyID)
+}
+
+// issueTokensWith signs a new access token and stores a new refresh token using db
+func (as *AuthService) issueTokensWith(db *gorm.DB, user models.User, familyID string) (*models.TokenResponse, error) {
+	now := time.Now()
+
+	accessToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		ID:        uuid.New().String(),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(as.accessTokenTTL)),
+	}).SignedString(as.secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Create(&models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(refreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: now.Add(as.refreshTokenTTL),
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &models.TokenResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(as.accessTokenTTL.Seconds()),
+		User:         &user,
+	}, nil
+}
+
+func revokeFamily(db *gorm.DB, familyID string) error {
+	return db.Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// randomToken returns a URL-safe random token with 256 bits of entropy
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken returns the hex SHA-256 of a high-entropy token for storage and lookup
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(token)))
+	return hex.EncodeToString(sum[:])
+}
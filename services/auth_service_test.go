@@ -0,0 +1,196 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestAuthService(t *testing.T) (*AuthService, models.User) {
+	t.Helper()
+
+	db := newTestDB(t)
+	userService := NewUserService(db, config.AuthConfig{})
+	auth := NewAuthService(db, userService, config.AuthConfig{
+		JWTSecret:       "test-jwt-secret",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+	})
+	user, err := userService.CreateUser(models.User{Name: "Test", Email: "test@example.com"})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return auth, user
+}
+
+func signTestToken(t *testing.T, method jwt.SigningMethod, key any, claims jwt.RegisteredClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return token
+}
+
+func TestAuthServiceAuthenticate(t *testing.T) {
+	auth, user := newTestAuthService(t)
+	issued, err := auth.LoginUser(user)
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+
+	secret := []byte("test-jwt-secret")
+	now := time.Now()
+	valid := jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+	}
+	with := func(change func(*jwt.RegisteredClaims)) jwt.RegisteredClaims {
+		claims := valid
+		change(&claims)
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "issued token", token: issued.AccessToken},
+		{name: "signed with the secret", token: signTestToken(t, jwt.SigningMethodHS256, secret, valid)},
+		{name: "wrong secret", token: signTestToken(t, jwt.SigningMethodHS256, []byte("other-secret"), valid), wantErr: ErrInvalidToken},
+		{name: "other algorithm", token: signTestToken(t, jwt.SigningMethodHS512, secret, valid), wantErr: ErrInvalidToken},
+		{name: "unsigned", token: signTestToken(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid), wantErr: ErrInvalidToken},
+		{name: "expired", token: signTestToken(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Minute))
+		})), wantErr: ErrInvalidToken},
+		{name: "no expiry", token: signTestToken(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.ExpiresAt = nil
+		})), wantErr: ErrInvalidToken},
+		{name: "other issuer", token: signTestToken(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.Issuer = "someone-else"
+		})), wantErr: ErrInvalidToken},
+		{name: "unknown user", token: signTestToken(t, jwt.SigningMethodHS256, secret, with(func(c *jwt.RegisteredClaims) {
+			c.Subject = "42"
+		})), wantErr: ErrInvalidToken},
+		{name: "malformed", token: "not-a-token", wantErr: ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := auth.Authenticate(tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Authenticate error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && got.ID != user.ID {
+				t.Fatalf("Authenticate = user %d, want %d", got.ID, user.ID)
+			}
+		})
+	}
+}
+
+func TestAuthServiceRefreshRotation(t *testing.T) {
+	tests := []struct {
+		name string
+		// run acts on a fresh login and returns a refresh token and whether it must still
+		// be accepted afterwards
+		run func(t *testing.T, auth *AuthService, first *models.TokenResponse) (string, bool)
+	}{
+		{
+			name: "rotated token is issued",
+			run: func(t *testing.T, auth *AuthService, first *models.TokenResponse) (string, bool) {
+				second := mustRefresh(t, auth, first.RefreshToken)
+				if second.RefreshToken == first.RefreshToken {
+					t.Fatal("Refresh returned the same refresh token")
+				}
+				return second.RefreshToken, true
+			},
+		},
+		{
+			name: "presented token cannot be used again",
+			run: func(t *testing.T, auth *AuthService, first *models.TokenResponse) (string, bool) {
+				mustRefresh(t, auth, first.RefreshToken)
+				return first.RefreshToken, false
+			},
+		},
+		{
+			name: "replaying a rotated token revokes the whole login",
+			run: func(t *testing.T, auth *AuthService, first *models.TokenResponse) (string, bool) {
+				second := mustRefresh(t, auth, first.RefreshToken)
+				if _, err := auth.Refresh(first.RefreshToken); !errors.Is(err, ErrInvalidToken) {
+					t.Fatalf("replayed Refresh error = %v, want %v", err, ErrInvalidToken)
+				}
+				return second.RefreshToken, false
+			},
+		},
+		{
+			name: "logout revokes the login",
+			run: func(t *testing.T, auth *AuthService, first *models.TokenResponse) (string, bool) {
+				second := mustRefresh(t, auth, first.RefreshToken)
+				if err := auth.Logout(second.RefreshToken); err != nil {
+					t.Fatalf("Logout: %v", err)
+				}
+				return second.RefreshToken, false
+			},
+		},
+		{
+			name: "unknown token",
+			run: func(t *testing.T, auth *AuthService, first *models.TokenResponse) (string, bool) {
+				return "unknown-refresh-token", false
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			auth, user := newTestAuthService(t)
+			first, err := auth.LoginUser(user)
+			if err != nil {
+				t.Fatalf("LoginUser: %v", err)
+			}
+
+			token, usable := tt.run(t, auth, first)
+			_, err = auth.Refresh(token)
+			if usable && err != nil {
+				t.Fatalf("Refresh: %v", err)
+			}
+			if !usable && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Refresh error = %v, want %v", err, ErrInvalidToken)
+			}
+		})
+	}
+}
+
+func TestAuthServiceRefreshKeepsOtherLogins(t *testing.T) {
+	auth, user := newTestAuthService(t)
+	first, err := auth.LoginUser(user)
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	other, err := auth.LoginUser(user)
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+
+	// Revoking one login after a replay must not sign the user out elsewhere
+	mustRefresh(t, auth, first.RefreshToken)
+	auth.Refresh(first.RefreshToken)
+	mustRefresh(t, auth, other.RefreshToken)
+}
+
+func mustRefresh(t *testing.T, auth *AuthService, refreshToken string) *models.TokenResponse {
+	t.Helper()
+	response, err := auth.Refresh(refreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+	return response
+}
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"sample-api/models"
+)
+
+const (
+	captionMaxLineLength = 42
+	captionMaxLines      = 2
+	captionMinDuration   = 1.0
+	captionMaxDuration   = 7.0
+
+	// translationBatchSize limits how many transcript segments go into one translation prompt
+	translationBatchSize = 40
+)
+
+var numberedLinePattern = regexp.MustCompile(`^\s*(\d+)\s*[:.)]\s*(.*)$`)
+
+// CaptionCue is a single caption shown on screen between Start and End seconds
+type CaptionCue struct {
+	Start float64
+	End   float64
+	Lines []string
+}
+
+// CaptionService converts transcripts into SRT and WebVTT captions
+type CaptionService struct {
+	aiService *AIService
+}
+
+// NewCaptionService creates a new caption service
+func NewCaptionService(aiService *AIService) *CaptionService {
+	return &CaptionService{
+		aiService: aiService,
+	}
+}
+
+// WithAIService returns a copy of the service that uses aiService, e.g. one scoped to an
+// organization's credentials
+func (cs *CaptionService) WithAIService(aiService *AIService) *CaptionService {
+	scoped := *cs
+	scoped.aiService = aiService
+	return &scoped
+}
+
+// Render builds cues from transcript segments and formats them as "srt" or "vtt"
+func (cs *CaptionService) Render(segments []models.TranscriptSegment, format string) (string, int, error) {
+	cues := BuildCaptionCues(segments)
+
+	switch format {
+	case "srt":
+		return FormatSRT(cues), len(cues), nil
+	case "vtt":
+		return FormatWebVTT(cues), len(cues), nil
+	default:
+		return "", 0, fmt.Errorf("unknown caption format: %s", format)
+	}
+}
+
+// Export renders captions and writes them to a new file next to audioPath
+func (cs *CaptionService) Export(audioPath string, segments []models.TranscriptSegment, format string) (string, int, error) {
+	content, cues, err := cs.Render(segments, format)
+	if err != nil {
+		return "", 0, err
+	}
+
+	outputPath := siblingPath(audioPath, "."+format)
+	if err := os.WriteFile(outputPath, []byte(content), 0644); err != nil {
+		return "", 0, fmt.Errorf("failed to write captions: %w", err)
+	}
+	return outputPath, cues, nil
+}
+
+// Translate translates the text of each segment into language using the AI provider,
+// keeping the original timestamps
+func (cs *CaptionService) Translate(segments []models.TranscriptSegment, language string) ([]models.TranscriptSegment, error) {
+	translated := make([]models.TranscriptSegment, 0, len(segments))
+
+	for batchStart := 0; batchStart < len(segments); batchStart += translationBatchSize {
+		batch := segments[batchStart:min(batchStart+translationBatchSize, len(segments))]
+
+		var lines strings.Builder
+		for i, segment := range batch {
+			fmt.Fprintf(&lines, "%d: %s\n", i+1, strings.Join(strings.Fields(segment.Text), " "))
+		}
+
+		prompt := fmt.Sprintf("Translate the following numbered caption lines into %s. "+
+			"Return exactly one line per number in the form \"N: translation\", keep the numbering "+
+			"and do not add any commentary.\n\n%s", language, lines.String())
+
+		response, err := cs.aiService.PromptAI(prompt)
+		if err != nil {
+			return nil, err
+		}
+
+		texts := map[int]string{}
+		for _, line := range strings.Split(response, "\n") {
+			if m := numberedLinePattern.FindStringSubmatch(line); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				texts[n] = strings.TrimSpace(m[2])
+			}
+		}
+
+		for i, segment := range batch {
+			text, ok := texts[i+1]
+			if !ok {
+				return nil, fmt.Errorf("translation is missing line %d of %d", batchStart+i+1, len(segments))
+			}
+			segment.Text = text
+			translated = append(translated, segment)
+		}
+	}
+
+	return translated, nil
+}
+
+// BuildCaptionCues wraps segment text into lines of at most 42 characters, splits it into
+// cues of at most two lines with time shared by text length, and keeps every cue between
+// one and seven seconds without overlapping the next one
+func BuildCaptionCues(segments []models.TranscriptSegment) []CaptionCue {
+	var cues []CaptionCue
+
+	for _, segment := range segments {
+		lines := wrapCaptionText(segment.Text, captionMaxLineLength)
+		if len(lines) == 0 {
+			continue
+		}
+
+		totalChars := 0
+		for _, line := range lines {
+			totalChars += utf8.RuneCountInString(line)
+		}
+
+		start := segment.Start
+		duration := math.Max(segment.End-segment.Start, 0)
+		for i := 0; i < len(lines); i += captionMaxLines {
+			cueLines := lines[i:min(i+captionMaxLines, len(lines))]
+
+			chars := 0
+			for _, line := range cueLines {
+				chars += utf8.RuneCountInString(line)
+			}
+			end := start + duration*float64(chars)/float64(totalChars)
+
+			cues = append(cues, CaptionCue{Start: start, End: end, Lines: cueLines})
+			start = end
+		}
+	}
+
+	for i := range cues {
+		nextStart := math.Inf(1)
+		if i+1 < len(cues) {
+			nextStart = cues[i+1].Start
+		}
+
+		if cues[i].End-cues[i].Start < captionMinDuration {
+			cues[i].End = math.Min(cues[i].Start+captionMinDuration, nextStart)
+		}
+		if cues[i].End-cues[i].Start > captionMaxDuration {
+			cues[i].End = cues[i].Start + captionMaxDuration
+		}
+		if cues[i].End > nextStart {
+			cues[i].End = nextStart
+		}
+	}
+
+	return cues
+}
+
+// FormatSRT renders cues in SubRip format
+func FormatSRT(cues []CaptionCue) string {
+	var b strings.Builder
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n",
+			i+1, formatCaptionTime(cue.Start, ","), formatCaptionTime(cue.End, ","), strings.Join(cue.Lines, "\n"))
+	}
+	return b.String()
+}
+
+// FormatWebVTT renders cues in WebVTT format
+func FormatWebVTT(cues []CaptionCue) string {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n\n")
+	for i, cue := range cues {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n",
+			i+1, formatCaptionTime(cue.Start, "."), formatCaptionTime(cue.End, "."), strings.Join(cue.Lines, "\n"))
+	}
+	return b.String()
+}
+
+// wrapCaptionText greedily wraps text into lines no longer than width where possible
+func wrapCaptionText(text string, width int) []string {
+	var lines []string
+	var current string
+
+	for _, word := range strings.Fields(text) {
+		switch {
+		case current == "":
+			current = word
+		case utf8.RuneCountInString(current)+1+utf8.RuneCountInString(word) <= width:
+			current += " " + word
+		default:
+			lines = append(lines, current)
+			current = word
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// formatCaptionTime formats seconds as HH:MM:SS followed by sep and milliseconds
+func formatCaptionTime(seconds float64, sep string) string {
+	ms := int64(math.Round(math.Max(seconds, 0) * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
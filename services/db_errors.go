@@ -0,0 +1,50 @@
+package services
+
+import (
+	"errors"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ConflictError reports that a value must be unique and is already in use. It wraps a
+// sentinel such as ErrEmailTaken so callers can match it with errors.Is.
+type ConflictError struct {
+	Field string
+	Err   error
+}
+
+func (e *ConflictError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConflictError) Unwrap() error {
+	return e.Err
+}
+
+// uniqueViolationMessages identify unique constraint failures from drivers that do not
+// translate them to gorm.ErrDuplicatedKey
+var uniqueViolationMessages = []string{
+	"unique constraint failed",                       // SQLite
+	"duplicate key value violates unique constraint", // PostgreSQL
+	"sqlstate 23505",                                 // PostgreSQL (pgx)
+	"duplicate entry",                                // MySQL
+	"error 1062",                                     // MySQL
+}
+
+// isUniqueViolation reports whether err was caused by a unique constraint or index
+func isUniqueViolation(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	for _, m := range uniqueViolationMessages {
+		if strings.Contains(message, m) {
+			return true
+		}
+	}
+	return false
+}
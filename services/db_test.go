@@ -0,0 +1,37 @@
+package services
+
+import (
+	"path/filepath"
+	"testing"
+
+	"sample-api/models"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// newTestDB opens a migrated database that is removed when the test ends
+func newTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	// Writers wait for each other instead of failing, for tests that run concurrently
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_busy_timeout=5000"), &gorm.Config{
+		Logger: logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("failed to open database: %v", err)
+	}
+	if err := db.AutoMigrate(&models.User{}, &models.MediaFile{}, &models.RefreshToken{}, &models.APIKey{}, &models.UserToken{},
+		&models.OIDCIdentity{}, &models.OIDCLoginState{}, &models.Organization{}, &models.Membership{},
+		&models.Invite{}, &models.OrganizationCredential{}, &models.UsageRecord{}, &models.AuditRecord{},
+		&models.UserCredential{}); err != nil {
+		t.Fatalf("failed to migrate database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"sample-api/config"
+	"sample-api/models"
+)
+
+var (
+	ErrEncryptionDisabled = errors.New("storing provider keys is disabled because no encryption key is configured")
+	ErrUnknownMasterKey   = errors.New("secret was encrypted with a master key that is no longer configured")
+)
+
+// Encryptor protects stored secrets with envelope encryption: every secret is encrypted
+// with its own random data key (AES-256-GCM), and the data key is encrypted with the
+// master key from the configuration. Former master keys are kept to open old secrets.
+type Encryptor struct {
+	current    string
+	masterKeys map[string][]byte
+}
+
+// NewEncryptor creates an encryptor from the configured master keys. Without a key,
+// Seal and Open fail with ErrEncryptionDisabled.
+func NewEncryptor(cfg config.EncryptionConfig) (*Encryptor, error) {
+	e := &Encryptor{masterKeys: make(map[string][]byte)}
+	for i, encoded := range append([]string{cfg.Key}, cfg.PreviousKeys...) {
+		if encoded == "" {
+			continue
+		}
+		key, err := config.MasterKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %w", err)
+		}
+		id := masterKeyID(key)
+		if i == 0 {
+			e.current = id
+		}
+		e.masterKeys[id] = key
+	}
+	return e, nil
+}
+
+// Enabled reports whether a master key is configured
+func (e *Encryptor) Enabled() bool {
+	return e.current != ""
+}
+
+// Seal encrypts plaintext. context is authenticated but not stored; the same context
+// must be passed to Open, which ties the secret to the record it belongs to.
+func (e *Encryptor) Seal(plaintext string, context string) (models.SealedSecret, error) {
+	if !e.Enabled() {
+		return models.SealedSecret{}, ErrEncryptionDisabled
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return models.SealedSecret{}, err
+	}
+	ciphertext, err := seal(dataKey, []byte(plaintext), []byte(context))
+	if err != nil {
+		return models.SealedSecret{}, err
+	}
+	wrappedKey, err := seal(e.masterKeys[e.current], dataKey, []byte(e.current))
+	if err != nil {
+		return models.SealedSecret{}, err
+	}
+
+	return models.SealedSecret{
+		KeyID:      e.current,
+		DataKey:    wrappedKey,
+		Ciphertext: ciphertext,
+	}, nil
+}
+
+// Open decrypts a secret sealed with the same context
+func (e *Encryptor) Open(secret models.SealedSecret, context string) (string, error) {
+	if !e.Enabled() {
+		return "", ErrEncryptionDisabled
+	}
+	masterKey, ok := e.masterKeys[secret.KeyID]
+	if !ok {
+		return "", ErrUnknownMasterKey
+	}
+
+	dataKey, err := open(masterKey, secret.DataKey, []byte(secret.KeyID))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	plaintext, err := open(dataKey, secret.Ciphertext, []byte(context))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// masterKeyID identifies a master key without revealing it
+func masterKeyID(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:4])
+}
+
+// seal encrypts with AES-256-GCM and prepends the random nonce
+func seal(key []byte, plaintext []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func open(key []byte, sealed []byte, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"sample-api/config"
+)
+
+func newMasterKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestEncryptor(t *testing.T, cfg config.EncryptionConfig) *Encryptor {
+	t.Helper()
+	encryptor, err := NewEncryptor(cfg)
+	if err != nil {
+		t.Fatalf("NewEncryptor: %v", err)
+	}
+	return encryptor
+}
+
+func TestEncryptorSealOpen(t *testing.T) {
+	oldKey, newKey := newMasterKey(t), newMasterKey(t)
+	const context = "user_credential:1:openai"
+
+	tests := []struct {
+		name        string
+		sealWith    config.EncryptionConfig
+		openWith    config.EncryptionConfig
+		openContext string
+		wantErr     error // nil means the secret must come back unchanged
+		wantAnyErr  bool
+	}{
+		{
+			name:        "round trip",
+			sealWith:    config.EncryptionConfig{Key: newKey},
+			openWith:    config.EncryptionConfig{Key: newKey},
+			openContext: context,
+		},
+		{
+			name:        "wrong context",
+			sealWith:    config.EncryptionConfig{Key: newKey},
+			openWith:    config.EncryptionConfig{Key: newKey},
+			openContext: "user_credential:2:openai",
+			wantAnyErr:  true,
+		},
+		{
+			name:        "rotated to a new key",
+			sealWith:    config.EncryptionConfig{Key: oldKey},
+			openWith:    config.EncryptionConfig{Key: newKey, PreviousKeys: []string{oldKey}},
+			openContext: context,
+		},
+		{
+			name:        "previous key dropped",
+			sealWith:    config.EncryptionConfig{Key: oldKey},
+			openWith:    config.EncryptionConfig{Key: newKey},
+			openContext: context,
+			wantErr:     ErrUnknownMasterKey,
+		},
+		{
+			name:        "encryption disabled",
+			sealWith:    config.EncryptionConfig{Key: newKey},
+			openWith:    config.EncryptionConfig{},
+			openContext: context,
+			wantErr:     ErrEncryptionDisabled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sealed, err := newTestEncryptor(t, tt.sealWith).Seal("sk-test-secret", context)
+			if err != nil {
+				t.Fatalf("Seal: %v", err)
+			}
+
+			plaintext, err := newTestEncryptor(t, tt.openWith).Open(sealed, tt.openContext)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Open error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantAnyErr:
+				if err == nil {
+					t.Fatal("Open succeeded, want an error")
+				}
+			default:
+				if err != nil {
+					t.Fatalf("Open: %v", err)
+				}
+				if plaintext != "sk-test-secret" {
+					t.Fatalf("Open = %q, want the sealed secret", plaintext)
+				}
+			}
+		})
+	}
+}
+
+func TestEncryptorSealDisabled(t *testing.T) {
+	_, err := newTestEncryptor(t, config.EncryptionConfig{}).Seal("sk-test-secret", "context")
+	if !errors.Is(err, ErrEncryptionDisabled) {
+		t.Fatalf("Seal error = %v, want %v", err, ErrEncryptionDisabled)
+	}
+}
+
+func TestEncryptorSealsWithCurrentKey(t *testing.T) {
+	oldKey, newKey := newMasterKey(t), newMasterKey(t)
+	rotated := newTestEncryptor(t, config.EncryptionConfig{Key: newKey, PreviousKeys: []string{oldKey}})
+
+	sealed, err := rotated.Seal("sk-test-secret", "context")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	// New secrets must not depend on a key that is being retired
+	if _, err := newTestEncryptor(t, config.EncryptionConfig{Key: newKey}).Open(sealed, "context"); err != nil {
+		t.Fatalf("Open with the current key only: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"sample-api/config"
+	"sample-api/services/providers"
+)
+
+// Keyring holds the server's API keys for every provider. Keys can be replaced at
+// runtime with Reload; services share one keyring so they all see the new keys.
+type Keyring struct {
+	mu    sync.RWMutex
+	pools map[string]*keyPool
+}
+
+// keyPool is the list of keys of one provider together with their health
+type keyPool struct {
+	provider string
+	strategy string
+	cooldown time.Duration
+
+	mu   sync.Mutex
+	keys []*poolKey
+	next int
+}
+
+type poolKey struct {
+	value string
+	// limitedUntil is when a rate-limited key is tried again
+	limitedUntil time.Time
+	// revoked keys were rejected by the provider and stay unused until the next reload
+	revoked bool
+}
+
+// NewKeyring creates a keyring from the configured keys
+func NewKeyring(cfg config.AIConfig) *Keyring {
+	k := &Keyring{}
+	k.Reload(cfg)
+	return k
+}
+
+// Reload replaces all keys. Rate limits and revocations of the old keys are forgotten.
+func (k *Keyring) Reload(cfg config.AIConfig) {
+	pools := make(map[string]*keyPool)
+	for _, provider := range config.Providers {
+		keys := cfg.Keys(provider)
+		if len(keys) == 0 {
+			continue
+		}
+		pool := &keyPool{provider: provider, strategy: cfg.KeyStrategy, cooldown: cfg.KeyCooldown}
+		for _, key := range keys {
+			pool.keys = append(pool.keys, &poolKey{value: key})
+		}
+		pools[provider] = pool
+	}
+	if pools[cfg.Provider] == nil {
+		slog.Warn("No API key is configured for the default AI provider", "provider", cfg.Provider)
+	}
+
+	k.mu.Lock()
+	k.pools = pools
+	k.mu.Unlock()
+}
+
+// Has reports whether any key is configured for provider
+func (k *Keyring) Has(provider string) bool {
+	return k.pool(provider) != nil
+}
+
+func (k *Keyring) pool(provider string) *keyPool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.pools[provider]
+}
+
+// Do calls fn with the provider's keys until one succeeds. A key that is rate limited
+// or rejected is set aside and the next one is tried; any other error is returned as is.
+func (k *Keyring) Do(ctx context.Context, provider string, fn func(apiKey string) error) error {
+	pool := k.pool(provider)
+	if pool == nil {
+		return fmt.Errorf("no API key configured for provider: %s", provider)
+	}
+
+	candidates := pool.candidates()
+	if len(candidates) == 0 {
+		return fmt.Errorf("all API keys for provider %s were rejected", provider)
+	}
+
+	var err error
+	for i, key := range candidates {
+		err = fn(key.value)
+		if !pool.setAside(ctx, key, err) {
+			return err
+		}
+		if i < len(candidates)-1 {
+			slog.WarnContext(ctx, "AI provider key failed, trying the next one", "provider", provider, "key", pool.index(key)+1, "keys", len(pool.keys), "error", err)
+		}
+	}
+	return err
+}
+
+// candidates returns the keys to try for one call, in order. Keys that are cooling down
+// after a rate limit come last so a request is still attempted when all are limited.
+func (p *keyPool) candidates() []*poolKey {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	start := 0
+	if p.strategy == config.KeyStrategyRoundRobin {
+		start = p.next
+		p.next = (p.next + 1) % len(p.keys)
+	}
+
+	now := time.Now()
+	var ready, limited []*poolKey
+	for i := range p.keys {
+		key := p.keys[(start+i)%len(p.keys)]
+		switch {
+		case key.revoked:
+		case now.Before(key.limitedUntil):
+			limited = append(limited, key)
+		default:
+			ready = append(ready, key)
+		}
+	}
+	return append(ready, limited...)
+}
+
+// setAside records the outcome of a call with key and reports whether another key
+// should be tried
+func (p *keyPool) setAside(ctx context.Context, key *poolKey, err error) bool {
+	var apiErr *providers.APIError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	switch {
+	case apiErr.Unauthorized():
+		key.revoked = true
+		slog.ErrorContext(ctx, "AI provider key was rejected and is disabled until the keys are reloaded", "provider", p.provider, "key", p.indexLocked(key)+1, "keys", len(p.keys))
+		return true
+	case apiErr.RateLimited():
+		key.limitedUntil = time.Now().Add(p.cooldown)
+		return true
+	}
+	return false
+}
+
+func (p *keyPool) index(key *poolKey) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.indexLocked(key)
+}
+
+func (p *keyPool) indexLocked(key *poolKey) int {
+	for i, k := range p.keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"sample-api/config"
+	"sample-api/services/providers"
+)
+
+func newTestKeyring(strategy string, keys ...string) *Keyring {
+	return NewKeyring(config.AIConfig{
+		Provider:    "openai",
+		OpenAIKeys:  keys,
+		KeyStrategy: strategy,
+		KeyCooldown: time.Minute,
+	})
+}
+
+func TestKeyringDo(t *testing.T) {
+	rateLimited := &providers.APIError{Provider: "openai", StatusCode: http.StatusTooManyRequests}
+	revoked := &providers.APIError{Provider: "openai", StatusCode: http.StatusUnauthorized}
+	forbidden := &providers.APIError{Provider: "openai", StatusCode: http.StatusForbidden}
+	failure := errors.New("connection reset")
+
+	tests := []struct {
+		name     string
+		strategy string
+		// failures are the errors each key returns; keys missing from it succeed
+		failures map[string]error
+		calls    int
+		// want is the keys tried, call after call
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name:     "failover uses the first key",
+			strategy: config.KeyStrategyFailover,
+			calls:    2,
+			want:     [][]string{{"a"}, {"a"}},
+		},
+		{
+			name:     "failover skips a rate-limited key until it cools down",
+			strategy: config.KeyStrategyFailover,
+			failures: map[string]error{"a": rateLimited},
+			calls:    2,
+			want:     [][]string{{"a", "b"}, {"b"}},
+		},
+		{
+			name:     "failover stops using a revoked key",
+			strategy: config.KeyStrategyFailover,
+			failures: map[string]error{"a": revoked},
+			calls:    2,
+			want:     [][]string{{"a", "b"}, {"b"}},
+		},
+		{
+			name:     "permission errors do not disable the key",
+			strategy: config.KeyStrategyFailover,
+			failures: map[string]error{"a": forbidden},
+			calls:    2,
+			want:     [][]string{{"a"}, {"a"}},
+			wantErr:  forbidden,
+		},
+		{
+			name:     "other errors are returned without trying another key",
+			strategy: config.KeyStrategyFailover,
+			failures: map[string]error{"a": failure},
+			calls:    1,
+			want:     [][]string{{"a"}},
+			wantErr:  failure,
+		},
+		{
+			name:     "rate-limited keys are still tried last",
+			strategy: config.KeyStrategyFailover,
+			failures: map[string]error{"a": rateLimited, "b": rateLimited, "c": rateLimited},
+			calls:    2,
+			want:     [][]string{{"a", "b", "c"}, {"a", "b", "c"}},
+			wantErr:  rateLimited,
+		},
+		{
+			name:     "round robin starts at the next key each call",
+			strategy: config.KeyStrategyRoundRobin,
+			calls:    4,
+			want:     [][]string{{"a"}, {"b"}, {"c"}, {"a"}},
+		},
+		{
+			name:     "round robin skips a revoked key",
+			strategy: config.KeyStrategyRoundRobin,
+			failures: map[string]error{"b": revoked},
+			calls:    4,
+			want:     [][]string{{"a"}, {"b", "c"}, {"c"}, {"a"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring := newTestKeyring(tt.strategy, "a", "b", "c")
+
+			var got [][]string
+			var err error
+			for range tt.calls {
+				var tried []string
+				err = keyring.Do(context.Background(), "openai", func(apiKey string) error {
+					tried = append(tried, apiKey)
+					return tt.failures[apiKey]
+				})
+				got = append(got, tried)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keys tried = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("last error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringAllKeysRevoked(t *testing.T) {
+	keyring := newTestKeyring(config.KeyStrategyFailover, "a")
+	revoked := &providers.APIError{Provider: "openai", StatusCode: http.StatusUnauthorized}
+
+	keyring.Do(context.Background(), "openai", func(string) error { return revoked })
+	err := keyring.Do(context.Background(), "openai", func(string) error {
+		t.Fatal("a revoked key was used")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("Do succeeded without any usable key")
+	}
+
+	// Reloading the keys brings them back
+	keyring.Reload(config.AIConfig{Provider: "openai", OpenAIKeys: []string{"a"}, KeyStrategy: config.KeyStrategyFailover})
+	if err := keyring.Do(context.Background(), "openai", func(string) error { return nil }); err != nil {
+		t.Fatalf("Do after reload: %v", err)
+	}
+}
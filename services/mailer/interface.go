@@ -0,0 +1,13 @@
+package mailer
+
+// Message is an email to a single recipient
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer defines the interface for email delivery backends
+type Mailer interface {
+	Send(msg Message) error
+}
@@ -0,0 +1,12 @@
+package mailer
+
+import "log/slog"
+
+// LogMailer writes messages to the log instead of sending them, for development
+type LogMailer struct{}
+
+// Send logs the message
+func (lm *LogMailer) Send(msg Message) error {
+	slog.Info("Email", "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
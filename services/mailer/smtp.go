@@ -0,0 +1,53 @@
+package mailer
+
+import (
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer delivers mail through an SMTP server. STARTTLS is used when the server
+// offers it; authentication is skipped when no username is set, which suits local
+// development sinks such as MailHog or smtp4dev.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers a plain text message
+func (sm *SMTPMailer) Send(msg Message) error {
+	if sm.Host == "" {
+		return fmt.Errorf("SMTP host not set")
+	}
+
+	var auth smtp.Auth
+	if sm.Username != "" {
+		auth = smtp.PlainAuth("", sm.Username, sm.Password, sm.Host)
+	}
+
+	headers := []string{
+		"From: " + sm.From,
+		"To: " + msg.To,
+		"Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject),
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Transfer-Encoding: 8bit",
+	}
+	body := strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(msg.Body, "\n", "\r\n")
+
+	addr := net.JoinHostPort(sm.Host, sm.Port)
+	if err := smtp.SendMail(addr, auth, sm.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("failed to send email via %s: %w", addr, err)
+	}
+
+	slog.Info("Email sent via SMTP", "to", msg.To, "subject", msg.Subject)
+	return nil
+}
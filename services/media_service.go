@@ -0,0 +1,215 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMediaNotFound    = errors.New("file not found")
+	ErrInvalidSignature = errors.New("invalid file link signature")
+	ErrLinkExpired      = errors.New("file link has expired")
+)
+
+// MediaService keeps track of generated files and issues signed download links for them
+type MediaService struct {
+	db      *gorm.DB
+	secret  []byte
+	linkTTL time.Duration
+
+	stopJanitor chan struct{}
+	janitorDone chan struct{}
+}
+
+// NewMediaService creates a new media service. Links are signed with the configured
+// secret, or a random one when it is not set, and stay valid for cfg.FileLinkTTL.
+func NewMediaService(db *gorm.DB, cfg config.MediaConfig) *MediaService {
+	return &MediaService{
+		db:      db,
+		secret:  signingSecret("media.file_link_secret", cfg.FileLinkSecret),
+		linkTTL: cfg.FileLinkTTL,
+	}
+}
+
+// Register records a file on disk owned by ownerID in organization orgID so it can be
+// downloaded until its link expires
+func (ms *MediaService) Register(path string, filename string, contentType string, ownerID uint, orgID uint) (models.MediaFile, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return models.MediaFile{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+
+	now := time.Now()
+	file := models.MediaFile{
+		ID:             uuid.New().String(),
+		OwnerID:        ownerID,
+		OrganizationID: orgID,
+		Path:           path,
+		Filename:       filename,
+		ContentType:    contentType,
+		Size:           info.Size(),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(ms.linkTTL),
+	}
+
+	if err := ms.db.Create(&file).Error; err != nil {
+		return models.MediaFile{}, err
+	}
+	return file, nil
+}
+
+// Get returns an unexpired file by ID if user may access it from organization orgID.
+// Files owned by other users or organizations are reported as not found.
+func (ms *MediaService) Get(id string, user models.User, orgID uint) (models.MediaFile, error) {
+	var file models.MediaFile
+	if err := ms.db.Where("expires_at >= ?", time.Now()).First(&file, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.MediaFile{}, ErrMediaNotFound
+		}
+		return models.MediaFile{}, err
+	}
+	if file.OrganizationID != orgID || !CanAccess(user, file.OwnerID) {
+		return models.MediaFile{}, ErrMediaNotFound
+	}
+	return file, nil
+}
+
+// SaveTranscript stores the transcript of a file made with the given language hint
+func (ms *MediaService) SaveTranscript(file models.MediaFile, language string, transcript *models.Transcript) error {
+	return ms.db.Model(&file).Select("transcript", "transcript_language").
+		Updates(&models.MediaFile{Transcript: transcript, TranscriptLanguage: language}).Error
+}
+
+// SignedURL builds a download link for the file that is valid until the file expires
+func (ms *MediaService) SignedURL(baseURL string, file models.MediaFile) string {
+	expires := strconv.FormatInt(file.ExpiresAt.Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", ms.sign(file.ID, expires))
+
+	return fmt.Sprintf("%s/files/%s?%s", baseURL, url.PathEscape(file.ID), query.Encode())
+}
+
+// Resolve verifies a signed link and returns the file it points to
+func (ms *MediaService) Resolve(id string, expires string, signature string) (models.MediaFile, error) {
+	expected := ms.sign(id, expires)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return models.MediaFile{}, ErrInvalidSignature
+	}
+
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return models.MediaFile{}, ErrInvalidSignature
+	}
+	if time.Now().Unix() > expiresAt {
+		return models.MediaFile{}, ErrLinkExpired
+	}
+
+	var file models.MediaFile
+	if err := ms.db.First(&file, "id = ?", id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.MediaFile{}, ErrMediaNotFound
+		}
+		return models.MediaFile{}, err
+	}
+
+	if _, err := os.Stat(file.Path); os.IsNotExist(err) {
+		return models.MediaFile{}, ErrMediaNotFound
+	}
+
+	return file, nil
+}
+
+// Discard removes registered files from disk and from the database, for files that
+// were registered as part of a result that could not be completed
+func (ms *MediaService) Discard(files ...models.MediaFile) error {
+	for _, file := range files {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove discarded file", "path", file.Path, "error", err)
+		}
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	ids := make([]string, len(files))
+	for i, file := range files {
+		ids[i] = file.ID
+	}
+	return ms.db.Where("id IN ?", ids).Delete(&models.MediaFile{}).Error
+}
+
+// PurgeExpired removes expired files from disk and from the database
+func (ms *MediaService) PurgeExpired() (int, error) {
+	var expired []models.MediaFile
+	if err := ms.db.Where("expires_at < ?", time.Now()).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+
+	for _, file := range expired {
+		if err := os.Remove(file.Path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove expired file", "path", file.Path, "error", err)
+			continue
+		}
+		if err := ms.db.Delete(&file).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return len(expired), nil
+}
+
+// StartJanitor periodically purges expired files in the background until StopJanitor
+func (ms *MediaService) StartJanitor(interval time.Duration) {
+	ms.stopJanitor = make(chan struct{})
+	ms.janitorDone = make(chan struct{})
+
+	go func() {
+		defer close(ms.janitorDone)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ms.stopJanitor:
+				return
+			case <-ticker.C:
+			}
+			if n, err := ms.PurgeExpired(); err != nil {
+				slog.Error("Failed to purge expired files", "error", err)
+			} else if n > 0 {
+				slog.Info("Purged expired files", "count", n)
+			}
+		}
+	}()
+}
+
+// StopJanitor stops the janitor and waits for a running purge to finish
+func (ms *MediaService) StopJanitor() {
+	if ms.stopJanitor == nil {
+		return
+	}
+	close(ms.stopJanitor)
+	<-ms.janitorDone
+	ms.stopJanitor = nil
+}
+
+func (ms *MediaService) sign(id string, expires string) string {
+	mac := hmac.New(sha256.New, ms.secret)
+	mac.Write([]byte(id + "." + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
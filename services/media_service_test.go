@@ -0,0 +1,112 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+
+	"gorm.io/gorm"
+)
+
+func TestMediaServiceResolve(t *testing.T) {
+	db := newTestDB(t)
+	media := NewMediaService(db, config.MediaConfig{FileLinkSecret: "test-link-secret", FileLinkTTL: time.Hour})
+
+	path := filepath.Join(t.TempDir(), "audio.mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := media.Register(path, "audio.mp3", "audio/mpeg", 1, 1)
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	link, err := url.Parse(media.SignedURL("https://api.example.com", file))
+	if err != nil {
+		t.Fatalf("SignedURL: %v", err)
+	}
+	expires := link.Query().Get("expires")
+	signature := link.Query().Get("signature")
+
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	otherSecret := NewMediaService(db, config.MediaConfig{FileLinkSecret: "other-secret", FileLinkTTL: time.Hour})
+
+	tests := []struct {
+		name      string
+		id        string
+		expires   string
+		signature string
+		wantErr   error
+	}{
+		{name: "valid link", id: file.ID, expires: expires, signature: signature},
+		{name: "tampered signature", id: file.ID, expires: expires, signature: tamper(signature), wantErr: ErrInvalidSignature},
+		{name: "missing signature", id: file.ID, expires: expires, wantErr: ErrInvalidSignature},
+		{name: "extended expiry", id: file.ID, expires: expires + "0", signature: signature, wantErr: ErrInvalidSignature},
+		{name: "other file", id: "other", expires: expires, signature: signature, wantErr: ErrInvalidSignature},
+		{name: "signed with another secret", id: file.ID, expires: expires, signature: otherSecret.sign(file.ID, expires), wantErr: ErrInvalidSignature},
+		{name: "expired link", id: file.ID, expires: past, signature: media.sign(file.ID, past), wantErr: ErrLinkExpired},
+		{name: "malformed expiry", id: file.ID, expires: "soon", signature: media.sign(file.ID, "soon"), wantErr: ErrInvalidSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved, err := media.Resolve(tt.id, tt.expires, tt.signature)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && resolved.ID != file.ID {
+				t.Fatalf("Resolve = file %q, want %q", resolved.ID, file.ID)
+			}
+		})
+	}
+}
+
+// tamper changes the last character of a hex signature
+func tamper(signature string) string {
+	last := "0"
+	if strings.HasSuffix(signature, last) {
+		last = "1"
+	}
+	return signature[:len(signature)-1] + last
+}
+
+func TestMediaServiceDiscard(t *testing.T) {
+	db := newTestDB(t)
+	media := NewMediaService(db, config.MediaConfig{FileLinkSecret: "test-link-secret", FileLinkTTL: time.Hour})
+
+	dir := t.TempDir()
+	var files []models.MediaFile
+	for _, name := range []string{"audio.mp3", "chunk_000.mp3", "kept.mp3"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("audio"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		file, err := media.Register(path, name, "audio/mpeg", 1, 1)
+		if err != nil {
+			t.Fatalf("Register: %v", err)
+		}
+		files = append(files, file)
+	}
+	// A file already gone from disk does not stop the rest from being discarded
+	os.Remove(files[1].Path)
+
+	if err := media.Discard(files[:2]...); err != nil {
+		t.Fatalf("Discard: %v", err)
+	}
+	for i, file := range files {
+		_, statErr := os.Stat(file.Path)
+		_, getErr := media.Get(file.ID, models.User{Model: gorm.Model{ID: 1}}, 1)
+		kept := i == 2
+		if (statErr == nil) != kept || (getErr == nil) != kept {
+			t.Errorf("%s: on disk = %v, registered = %v, want %v", file.Filename, statErr == nil, getErr == nil, kept)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"sample-api/config"
+	"sample-api/metrics"
+	"sample-api/models"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcLoginStateTTL = 10 * time.Minute
+	oidcTimeout       = 15 * time.Second
+)
+
+var (
+	ErrOIDCDisabled      = errors.New("single sign-on is not configured")
+	ErrOIDCLogin         = errors.New("single sign-on login failed")
+	ErrOIDCEmailRequired = errors.New("identity provider did not return a verified email address")
+	ErrOIDCDomain        = errors.New("email domain is not allowed to sign in")
+)
+
+// OIDCService signs users in with an OpenID Connect identity provider using the
+// authorization code flow with PKCE
+type OIDCService struct {
+	db             *gorm.DB
+	userService    *UserService
+	authService    *AuthService
+	issuer         string
+	clientID       string
+	clientSecret   string
+	redirectURL    string
+	scopes         []string
+	allowedDomains []string
+
+	// The provider is discovered on first use so the API can start while the IdP is down
+	mu       sync.Mutex
+	provider *oidc.Provider
+}
+
+// NewOIDCService creates a new OIDC service. It is enabled by an issuer and client ID
+// (plus a client secret for confidential clients). cfg.RedirectURL overrides the callback
+// URL derived from the request, cfg.Scopes adds scopes and cfg.AllowedDomains restricts
+// sign-in to email domains.
+func NewOIDCService(db *gorm.DB, userService *UserService, authService *AuthService, cfg config.OIDCConfig) *OIDCService {
+	scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+	for _, scope := range cfg.Scopes {
+		for _, scope := range strings.Fields(scope) {
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	var allowedDomains []string
+	for _, domain := range cfg.AllowedDomains {
+		if domain = strings.TrimPrefix(strings.TrimSpace(domain), "@"); domain != "" {
+			allowedDomains = append(allowedDomains, strings.ToLower(domain))
+		}
+	}
+
+	return &OIDCService{
+		db:             db,
+		userService:    userService,
+		authService:    authService,
+		issuer:         cfg.Issuer,
+		clientID:       cfg.ClientID,
+		clientSecret:   cfg.ClientSecret,
+		redirectURL:    cfg.RedirectURL,
+		scopes:         scopes,
+		allowedDomains: allowedDomains,
+	}
+}
+
+// Enabled reports whether an identity provider is configured
+func (s *OIDCService) Enabled() bool {
+	return s.issuer != "" && s.clientID != ""
+}
+
+// AuthURL starts a login and returns the identity provider URL to send the browser to.
+// defaultRedirectURL is used as the callback unless a redirect URL is configured.
+func (s *OIDCService) AuthURL(defaultRedirectURL string) (string, error) {
+	config, err := s.oauthConfig(defaultRedirectURL)
+	if err != nil {
+		return "", err
+	}
+
+	state, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	if err := s.db.Create(&models.OIDCLoginState{
+		StateHash:    hashToken(state),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		RedirectURL:  config.RedirectURL,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+	}).Error; err != nil {
+		return "", err
+	}
+
+	return config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), nil
+}
+
+// Callback finishes a login: it exchanges the code, validates the ID token and signs in
+// the linked user, linking or creating one by verified email on first login
+func (s *OIDCService) Callback(ctx context.Context, state string, code string) (*models.TokenResponse, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	loginState, err := s.consumeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := s.oauthConfig(loginState.RedirectURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, oidcTimeout)
+	defer cancel()
+
+	token, err := config.Exchange(ctx, code, oauth2.VerifierOption(loginState.CodeVerifier))
+	if err != nil {
+		slog.WarnContext(ctx, "OIDC code exchange failed", "error", err)
+		return nil, ErrOIDCLogin
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		slog.WarnContext(ctx, "OIDC token response has no id_token")
+		return nil, ErrOIDCLogin
+	}
+
+	provider, err := s.discover()
+	if err != nil {
+		return nil, err
+	}
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: s.clientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		slog.WarnContext(ctx, "OIDC ID token verification failed", "error", err)
+		return nil, ErrOIDCLogin
+	}
+	if idToken.Nonce != loginState.Nonce {
+		slog.WarnContext(ctx, "OIDC ID token nonce mismatch")
+		return nil, ErrOIDCLogin
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified any    `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		slog.WarnContext(ctx, "OIDC ID token claims are invalid", "error", err)
+		return nil, ErrOIDCLogin
+	}
+
+	// Some providers send email_verified as a string
+	email := strings.ToLower(strings.TrimSpace(claims.Email))
+	if email == "" || (claims.EmailVerified != true && claims.EmailVerified != "true") {
+		return nil, ErrOIDCEmailRequired
+	}
+	if !s.domainAllowed(email) {
+		return nil, ErrOIDCDomain
+	}
+
+	user, err := s.linkUser(idToken.Issuer, idToken.Subject, email, claims.Name)
+	if err != nil {
+		return nil, err
+	}
+	return s.authService.LoginUser(user)
+}
+
+// linkUser finds the user linked to the identity, or links the user with the same email,
+// or creates a new user. The identity provider has verified the email in every case.
+func (s *OIDCService) linkUser(issuer string, subject string, email string, name string) (models.User, error) {
+	var identity models.OIDCIdentity
+	err := s.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&identity).Error
+	if err == nil {
+		user, err := s.userService.GetUser(identity.UserID)
+		if errors.Is(err, ErrUserNotFound) {
+			// The linked user was deleted; deleted accounts cannot sign in
+			return models.User{}, ErrOIDCLogin
+		}
+		return user, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.User{}, err
+	}
+
+	var user models.User
+	err = s.db.Where("LOWER(email) = ?", email).First(&user).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		if name = strings.TrimSpace(name); name == "" {
+			name = strings.Split(email, "@")[0]
+		}
+		now := time.Now()
+		user, err = s.userService.CreateUser(models.User{Name: name, Email: email, EmailVerifiedAt: &now})
+		if err != nil {
+			return models.User{}, err
+		}
+	case err != nil:
+		return models.User{}, err
+	case user.EmailVerifiedAt == nil:
+		// Whoever registered the address never proved they own it, so they may not be
+		// the person the provider vouches for. Take the account over with nothing the
+		// registrant set up still working: their password, sessions and API keys.
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			if err := tx.Model(&user).Updates(map[string]any{"email_verified_at": now, "password_hash": ""}).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.RefreshToken{}).
+				Where("user_id = ? AND revoked_at IS NULL", user.ID).
+				Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+			if err := tx.Model(&models.APIKey{}).
+				Where("user_id = ? AND revoked_at IS NULL", user.ID).
+				Update("revoked_at", now).Error; err != nil {
+				return err
+			}
+			return tx.Model(&models.UserToken{}).
+				Where("user_id = ? AND used_at IS NULL", user.ID).
+				Update("used_at", now).Error
+		}); err != nil {
+			return models.User{}, err
+		}
+		if err := s.userService.promoteAdmins(s.db.Where("id = ?", user.ID)); err != nil {
+			return models.User{}, err
+		}
+		if user, err = s.userService.GetUser(user.ID); err != nil {
+			return models.User{}, err
+		}
+	}
+
+	if err := s.db.Create(&models.OIDCIdentity{
+		UserID:  user.ID,
+		Issuer:  issuer,
+		Subject: subject,
+		Email:   email,
+	}).Error; err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// consumeState deletes a pending login and returns it if it has not expired
+func (s *OIDCService) consumeState(state string) (models.OIDCLoginState, error) {
+	var loginState models.OIDCLoginState
+	if err := s.db.Where("state_hash = ?", hashToken(state)).First(&loginState).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return models.OIDCLoginState{}, ErrInvalidToken
+		}
+		return models.OIDCLoginState{}, err
+	}
+
+	// Only one request can delete the state, so a replayed callback fails
+	result := s.db.Where("state_hash = ?", loginState.StateHash).Delete(&models.OIDCLoginState{})
+	if result.Error != nil {
+		return models.OIDCLoginState{}, result.Error
+	}
+	if result.RowsAffected == 0 || time.Now().After(loginState.ExpiresAt) {
+		return models.OIDCLoginState{}, ErrInvalidToken
+	}
+
+	// Opportunistically drop logins that were never finished
+	s.db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{})
+	return loginState, nil
+}
+
+func (s *OIDCService) oauthConfig(defaultRedirectURL string) (*oauth2.Config, error) {
+	if !s.Enabled() {
+		return nil, ErrOIDCDisabled
+	}
+
+	provider, err := s.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	redirectURL := s.redirectURL
+	if redirectURL == "" {
+		redirectURL = defaultRedirectURL
+	}
+
+	return &oauth2.Config{
+		ClientID:     s.clientID,
+		ClientSecret: s.clientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  redirectURL,
+		Scopes:       s.scopes,
+	}, nil
+}
+
+// discover fetches the issuer's discovery document once and caches the result
+func (s *OIDCService) discover() (*oidc.Provider, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.provider != nil {
+		metrics.CacheRequests.WithLabelValues("oidc_discovery", "hit").Inc()
+		return s.provider, nil
+	}
+	metrics.CacheRequests.WithLabelValues("oidc_discovery", "miss").Inc()
+
+	// The provider keeps this context to fetch signing keys later, so it is never cancelled
+	ctx := oidc.ClientContext(context.Background(), &http.Client{Timeout: oidcTimeout})
+	provider, err := oidc.NewProvider(ctx, s.issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OIDC issuer %s: %w", s.issuer, err)
+	}
+	s.provider = provider
+	return provider, nil
+}
+
+func (s *OIDCService) domainAllowed(email string) bool {
+	if len(s.allowedDomains) == 0 {
+		return true
+	}
+	return slices.Contains(s.allowedDomains, email[strings.LastIndex(email, "@")+1:])
+}
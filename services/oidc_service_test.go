@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testOIDCClientID = "test-client"
+
+// testIssuer is an OpenID Connect provider serving discovery, signing keys and a token
+// endpoint. Each authorization code is exchanged for the ID token claims registered for it.
+type testIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	claims map[string]jwt.MapClaims
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &testIssuer{key: key, claims: map[string]jwt.MapClaims{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                issuer.server.URL,
+			"authorization_endpoint":                issuer.server.URL + "/authorize",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"jwks_uri":                              issuer.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("GET /keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mu.Lock()
+		claims, ok := issuer.claims[r.FormValue("code")]
+		issuer.mu.Unlock()
+		if !ok || r.FormValue("code_verifier") == "" {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+// authorize stands in for the browser visiting the identity provider: it registers the
+// claims the returned code is exchanged for
+func (i *testIssuer) authorize(code string, claims jwt.MapClaims) {
+	now := time.Now()
+	token := jwt.MapClaims{
+		"iss": i.server.URL,
+		"sub": "subject-1",
+		"aud": testOIDCClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		token[name] = value
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.claims[code] = token
+}
+
+// startLogin returns the state and nonce of a new login
+func startLogin(t *testing.T, oidcService *OIDCService) (string, string) {
+	t.Helper()
+
+	authURL, err := oidcService.AuthURL("https://api.example.com/auth/oidc/callback")
+	if err != nil {
+		t.Fatalf("AuthURL: %v", err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("AuthURL returned %q: %v", authURL, err)
+	}
+	return parsed.Query().Get("state"), parsed.Query().Get("nonce")
+}
+
+type testOIDC struct {
+	issuer  *testIssuer
+	service *OIDCService
+	users   *UserService
+	auth    *AuthService
+	apiKeys *APIKeyService
+}
+
+func newTestOIDC(t *testing.T, allowedDomains ...string) testOIDC {
+	t.Helper()
+
+	issuer := newTestIssuer(t)
+	db := newTestDB(t)
+	authConfig := config.AuthConfig{
+		JWTSecret:       "test-jwt-secret",
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		AdminEmails:     []string{"boss@example.com"},
+	}
+	users := NewUserService(db, authConfig)
+	auth := NewAuthService(db, users, authConfig)
+	return testOIDC{
+		issuer: issuer,
+		service: NewOIDCService(db, users, auth, config.OIDCConfig{
+			Issuer:         issuer.server.URL,
+			ClientID:       testOIDCClientID,
+			ClientSecret:   "test-secret",
+			AllowedDomains: allowedDomains,
+		}),
+		users:   users,
+		auth:    auth,
+		apiKeys: NewAPIKeyService(db, users),
+	}
+}
+
+func TestOIDCServiceCallback(t *testing.T) {
+	tests := []struct {
+		name           string
+		allowedDomains []string
+		claims         jwt.MapClaims
+		wrongNonce     bool
+		wantErr        error
+	}{
+		{
+			name:   "verified email",
+			claims: jwt.MapClaims{"email": "new@example.com", "email_verified": true, "name": "New"},
+		},
+		{
+			name:   "email_verified sent as a string",
+			claims: jwt.MapClaims{"email": "new@example.com", "email_verified": "true"},
+		},
+		{
+			name:    "unverified email",
+			claims:  jwt.MapClaims{"email": "new@example.com", "email_verified": false},
+			wantErr: ErrOIDCEmailRequired,
+		},
+		{
+			name:    "missing email",
+			claims:  jwt.MapClaims{"email_verified": true},
+			wantErr: ErrOIDCEmailRequired,
+		},
+		{
+			name:           "allowed domain",
+			allowedDomains: []string{"@Example.com"},
+			claims:         jwt.MapClaims{"email": "new@example.com", "email_verified": true},
+		},
+		{
+			name:           "domain not allowed",
+			allowedDomains: []string{"example.com"},
+			claims:         jwt.MapClaims{"email": "new@example.com.evil.io", "email_verified": true},
+			wantErr:        ErrOIDCDomain,
+		},
+		{
+			name:       "nonce mismatch",
+			claims:     jwt.MapClaims{"email": "new@example.com", "email_verified": true},
+			wrongNonce: true,
+			wantErr:    ErrOIDCLogin,
+		},
+		{
+			name:    "token for another client",
+			claims:  jwt.MapClaims{"email": "new@example.com", "email_verified": true, "aud": "other-client"},
+			wantErr: ErrOIDCLogin,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oidc := newTestOIDC(t, tt.allowedDomains...)
+			state, nonce := startLogin(t, oidc.service)
+			if tt.wrongNonce {
+				nonce = "other-nonce"
+			}
+			tt.claims["nonce"] = nonce
+			oidc.issuer.authorize("code", tt.claims)
+
+			tokens, err := oidc.service.Callback(context.Background(), state, "code")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Callback error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			user, err := oidc.auth.Authenticate(tokens.AccessToken)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if user.Email != "new@example.com" || user.EmailVerifiedAt == nil {
+				t.Errorf("signed in as %q (verified: %v), want a verified new@example.com", user.Email, user.EmailVerifiedAt != nil)
+			}
+		})
+	}
+}
+
+func TestOIDCServiceCallbackReplay(t *testing.T) {
+	oidc := newTestOIDC(t)
+	state, nonce := startLogin(t, oidc.service)
+	oidc.issuer.authorize("code", jwt.MapClaims{"email": "new@example.com", "email_verified": true, "nonce": nonce})
+
+	if _, err := oidc.service.Callback(context.Background(), state, "code"); err != nil {
+		t.Fatalf("Callback: %v", err)
+	}
+	if _, err := oidc.service.Callback(context.Background(), state, "code"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("replayed Callback error = %v, want %v", err, ErrInvalidToken)
+	}
+	if _, err := oidc.service.Callback(context.Background(), "unknown-state", "code"); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("Callback with an unknown state error = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+func TestOIDCServiceLinking(t *testing.T) {
+	tests := []struct {
+		name string
+		// verified marks the existing local account's email as verified
+		verified bool
+		// wantLocalLogin is whether the local password still works after linking
+		wantLocalLogin bool
+		wantRole       string
+	}{
+		{name: "verified local account keeps its credentials", verified: true, wantLocalLogin: true, wantRole: models.RoleMember},
+		// The provider verified the address, which is an admin email
+		{name: "unverified local account is taken over", verified: false, wantLocalLogin: false, wantRole: models.RoleAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oidc := newTestOIDC(t)
+			registered, err := oidc.auth.Register(models.RegisterRequest{Name: "Local", Email: "Boss@example.com", Password: "local password"})
+			if err != nil {
+				t.Fatalf("Register: %v", err)
+			}
+			local := *registered.User
+			if tt.verified {
+				now := time.Now()
+				if err := oidc.service.db.Model(&local).Update("email_verified_at", now).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			session, err := oidc.auth.Login("boss@example.com", "local password")
+			if err != nil {
+				t.Fatalf("Login: %v", err)
+			}
+			_, apiKey, err := oidc.apiKeys.Create(local.ID, "local", []string{ScopeAI})
+			if err != nil {
+				t.Fatalf("create API key: %v", err)
+			}
+
+			state, nonce := startLogin(t, oidc.service)
+			oidc.issuer.authorize("code", jwt.MapClaims{"email": "boss@example.com", "email_verified": true, "nonce": nonce})
+			tokens, err := oidc.service.Callback(context.Background(), state, "code")
+			if err != nil {
+				t.Fatalf("Callback: %v", err)
+			}
+
+			linked, err := oidc.auth.Authenticate(tokens.AccessToken)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if linked.ID != local.ID {
+				t.Fatalf("signed in as user %d, want the local account %d", linked.ID, local.ID)
+			}
+			if linked.Role != tt.wantRole {
+				t.Errorf("role = %q, want %q", linked.Role, tt.wantRole)
+			}
+
+			_, loginErr := oidc.auth.Login("boss@example.com", "local password")
+			_, refreshErr := oidc.auth.Refresh(session.RefreshToken)
+			_, _, keyErr := oidc.apiKeys.Authenticate(apiKey, "127.0.0.1")
+			for name, err := range map[string]error{"password login": loginErr, "refresh": refreshErr, "API key": keyErr} {
+				if works := err == nil; works != tt.wantLocalLogin {
+					t.Errorf("%s works = %v, want %v (error: %v)", name, works, tt.wantLocalLogin, err)
+				}
+			}
+
+			// Later logins find the identity without looking at the email again
+			state, nonce = startLogin(t, oidc.service)
+			oidc.issuer.authorize("again", jwt.MapClaims{"email": "renamed@example.com", "email_verified": true, "nonce": nonce})
+			tokens, err = oidc.service.Callback(context.Background(), state, "again")
+			if err != nil {
+				t.Fatalf("second Callback: %v", err)
+			}
+			if again, err := oidc.auth.Authenticate(tokens.AccessToken); err != nil || again.ID != local.ID {
+				t.Fatalf("second login signed in as user %d (%v), want %d", again.ID, err, local.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+	"sample-api/services/mailer"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrMemberNotFound       = errors.New("member not found")
+	ErrInviteNotFound       = errors.New("invite not found")
+	ErrCredentialNotFound   = errors.New("credential not found")
+	ErrOrgForbidden         = errors.New("your organization role does not allow this action")
+	ErrLastOwner            = errors.New("an organization must keep at least one owner")
+	ErrAlreadyMember        = errors.New("user is already a member of the organization")
+	ErrInviteEmailMismatch  = errors.New("invite was sent to a different email address")
+	ErrQuotaExceeded        = errors.New("organization has used its monthly request quota")
+	ErrUnknownProvider      = errors.New("unknown AI provider")
+	ErrUnknownModel         = errors.New("unknown model for the selected AI provider")
+	ErrInvitesDisabled      = errors.New("invites are disabled until organizations.invite_url is configured")
+	ErrMissingCredential    = errors.New("no API key is configured for the selected AI provider")
+)
+
+// OrganizationService manages organizations, their members and invites, per-organization
+// provider credentials, and usage metering against quotas
+type OrganizationService struct {
+	db              *gorm.DB
+	userCredentials *UserCredentialService
+	encryptor       *Encryptor
+	mailer          mailer.Mailer
+	inviteTTL       time.Duration
+	inviteURL       string
+}
+
+// NewOrganizationService creates a new organization service. Invite links point at the
+// frontend page cfg.InviteURL; without it no invites are sent.
+func NewOrganizationService(db *gorm.DB, userCredentials *UserCredentialService, encryptor *Encryptor, cfg config.OrganizationsConfig, mail config.MailConfig) *OrganizationService {
+	if cfg.InviteURL == "" {
+		slog.Warn("organizations.invite_url is not configured, invites are disabled")
+	}
+	return &OrganizationService{
+		db:              db,
+		userCredentials: userCredentials,
+		encryptor:       encryptor,
+		mailer:          newMailer(mail),
+		inviteTTL:       cfg.InviteTTL,
+		inviteURL:       cfg.InviteURL,
+	}
+}
+
+// CreateOrganization creates an organization with user as its owner
+func (s *OrganizationService) CreateOrganization(user models.User, name string) (models.Organization, error) {
+	org := models.Organization{Name: name}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&org).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{OrganizationID: org.ID, UserID: user.ID, Role: models.OrgRoleOwner}).Error
+	})
+	if err != nil {
+		return models.Organization{}, err
+	}
+	return org, nil
+}
+
+// ListForUser returns the user's memberships with their organizations
+func (s *OrganizationService) ListForUser(userID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := s.db.Preload("Organization").Where("user_id = ?", userID).Order("id").Find(&memberships).Error
+	return memberships, err
+}
+
+// Resolve returns the organization a request acts in and the user's role there. orgID
+// is taken from the X-Organization-ID header or a path parameter; when it is empty the
+// user's first organization is used, and a personal one is created if they have none.
+// Server admins act as owners of every organization.
+func (s *OrganizationService) Resolve(user models.User, orgID string) (models.Organization, string, error) {
+	if orgID == "" {
+		return s.defaultOrganization(user)
+	}
+
+	id, err := strconv.ParseUint(orgID, 10, 64)
+	if err != nil {
+		return models.Organization{}, "", ErrOrganizationNotFound
+	}
+
+	var org models.Organization
+	if err := s.db.First(&org, id).Error; err != nil {
+		return models.Organization{}, "", translateOrgError(err, ErrOrganizationNotFound)
+	}
+
+	var membership models.Membership
+	err = s.db.Where("organization_id = ? AND user_id = ?", org.ID, user.ID).First(&membership).Error
+	switch {
+	case err == nil:
+		return org, membership.Role, nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return models.Organization{}, "", err
+	case user.Role == models.RoleAdmin:
+		return org, models.OrgRoleOwner, nil
+	default:
+		// Other organizations are reported as missing rather than forbidden
+		return models.Organization{}, "", ErrOrganizationNotFound
+	}
+}
+
+func (s *OrganizationService) defaultOrganization(user models.User) (models.Organization, string, error) {
+	var membership models.Membership
+	err := s.db.Preload("Organization").Where("user_id = ?", user.ID).Order("id").First(&membership).Error
+	if err == nil && membership.Organization != nil {
+		return *membership.Organization, membership.Role, nil
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.Organization{}, "", err
+	}
+
+	org, err := s.CreateOrganization(user, user.Name+"'s workspace")
+	if err != nil {
+		return models.Organization{}, "", err
+	}
+	return org, models.OrgRoleOwner, nil
+}
+
+// UpdateOrganization changes an organization's name or AI provider
+func (s *OrganizationService) UpdateOrganization(org models.Organization, req models.UpdateOrganizationRequest) (models.Organization, error) {
+	if req.Name != nil {
+		org.Name = *req.Name
+	}
+	if req.AIProvider != nil {
+		org.AIProvider = *req.AIProvider
+	}
+	if err := s.db.Save(&org).Error; err != nil {
+		return models.Organization{}, err
+	}
+	return org, nil
+}
+
+// SetQuota sets an organization's monthly request quota; 0 removes the limit
+func (s *OrganizationService) SetQuota(org models.Organization, quota int) (models.Organization, error) {
+	if err := s.db.Model(&org).Update("monthly_request_quota", quota).Error; err != nil {
+		return models.Organization{}, err
+	}
+	org.MonthlyRequestQuota = quota
+	return org, nil
+}
+
+// ListMembers returns the organization's memberships with their users
+func (s *OrganizationService) ListMembers(orgID uint) ([]models.Membership, error) {
+	var memberships []models.Membership
+	err := s.db.Preload("User").Where("organization_id = ?", orgID).Order("id").Find(&memberships).Error
+	return memberships, err
+}
+
+// UpdateMemberRole changes a member's role. actorRole is the caller's role: admins can
+// manage members and admins, only owners can grant or take away ownership.
+func (s *OrganizationService) UpdateMemberRole(orgID uint, userID uint, role string, actorRole string) (models.Membership, error) {
+	var membership models.Membership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+			return translateOrgError(err, ErrMemberNotFound)
+		}
+		if (membership.Role == models.OrgRoleOwner || role == models.OrgRoleOwner) && actorRole != models.OrgRoleOwner {
+			return ErrOrgForbidden
+		}
+		if membership.Role == models.OrgRoleOwner && role != models.OrgRoleOwner {
+			if err := ensureAnotherOwner(tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		membership.Role = role
+		return tx.Model(&membership).Update("role", role).Error
+	})
+	if err != nil {
+		return models.Membership{}, err
+	}
+	return membership, nil
+}
+
+// RemoveMember removes a user from an organization. Members may remove themselves.
+func (s *OrganizationService) RemoveMember(orgID uint, userID uint, actor models.User, actorRole string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var membership models.Membership
+		if err := tx.Where("organization_id = ? AND user_id = ?", orgID, userID).First(&membership).Error; err != nil {
+			return translateOrgError(err, ErrMemberNotFound)
+		}
+		if actor.ID != userID {
+			if !HasOrgRole(actorRole, models.OrgRoleAdmin) ||
+				(membership.Role == models.OrgRoleOwner && actorRole != models.OrgRoleOwner) {
+				return ErrOrgForbidden
+			}
+		}
+		if membership.Role == models.OrgRoleOwner {
+			if err := ensureAnotherOwner(tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&membership).Error
+	})
+}
+
+// CreateInvite stores an invite and emails its link to the invited address
+func (s *OrganizationService) CreateInvite(org models.Organization, inviter models.User, req models.CreateInviteRequest) (models.Invite, error) {
+	if s.inviteURL == "" {
+		return models.Invite{}, ErrInvitesDisabled
+	}
+
+	var existing int64
+	if err := s.db.Model(&models.Membership{}).
+		Joins("JOIN users ON users.id = memberships.user_id AND users.deleted_at IS NULL").
+		Where("memberships.organization_id = ? AND LOWER(users.email) = ?", org.ID, req.Email).
+		Count(&existing).Error; err != nil {
+		return models.Invite{}, err
+	}
+	if existing > 0 {
+		return models.Invite{}, ErrAlreadyMember
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		return models.Invite{}, err
+	}
+	link, err := tokenLink(s.inviteURL, token)
+	if err != nil {
+		return models.Invite{}, err
+	}
+
+	role := req.Role
+	if role == "" {
+		role = models.OrgRoleMember
+	}
+	invite := models.Invite{
+		OrganizationID: org.ID,
+		Email:          req.Email,
+		Role:           role,
+		TokenHash:      hashToken(token),
+		InvitedByID:    inviter.ID,
+		ExpiresAt:      time.Now().Add(s.inviteTTL),
+	}
+	if err := s.db.Create(&invite).Error; err != nil {
+		return models.Invite{}, err
+	}
+
+	msg, err := mailer.Render("organization_invite", invite.Email, map[string]any{
+		"Organization": org.Name,
+		"InvitedBy":    inviter.Name,
+		"Role":         role,
+		"Link":         link,
+		"ExpiresIn":    formatTTL(s.inviteTTL),
+	})
+	if err != nil {
+		return models.Invite{}, err
+	}
+	if err := s.mailer.Send(msg); err != nil {
+		return models.Invite{}, fmt.Errorf("failed to send invite: %w", err)
+	}
+	return invite, nil
+}
+
+// ListInvites returns the organization's pending invites
+func (s *OrganizationService) ListInvites(orgID uint) ([]models.Invite, error) {
+	var invites []models.Invite
+	err := s.db.Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", orgID, time.Now()).
+		Order("id").Find(&invites).Error
+	return invites, err
+}
+
+// RevokeInvite deletes a pending invite
+func (s *OrganizationService) RevokeInvite(orgID uint, inviteID uint) error {
+	result := s.db.Where("organization_id = ? AND accepted_at IS NULL", orgID).Delete(&models.Invite{}, inviteID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInviteNotFound
+	}
+	return nil
+}
+
+// AcceptInvite adds user to the invite's organization. The invite must have been sent
+// to the user's email address.
+func (s *OrganizationService) AcceptInvite(user models.User, token string) (models.Membership, error) {
+	var membership models.Membership
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var invite models.Invite
+		if err := tx.Where("token_hash = ?", hashToken(token)).First(&invite).Error; err != nil {
+			return translateOrgError(err, ErrInvalidToken)
+		}
+		if invite.AcceptedAt != nil || time.Now().After(invite.ExpiresAt) {
+			return ErrInvalidToken
+		}
+		if models.NormalizeEmail(invite.Email) != models.NormalizeEmail(user.Email) {
+			return ErrInviteEmailMismatch
+		}
+
+		result := tx.Model(&models.Invite{}).
+			Where("id = ? AND accepted_at IS NULL", invite.ID).
+			Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidToken
+		}
+
+		membership = models.Membership{OrganizationID: invite.OrganizationID, UserID: user.ID, Role: invite.Role}
+		if err := tx.Create(&membership).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrAlreadyMember
+			}
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return models.Membership{}, err
+	}
+	return membership, nil
+}
+
+// SetCredential stores or replaces the organization's API key for a provider
+func (s *OrganizationService) SetCredential(orgID uint, provider string, req models.SetCredentialRequest) (models.OrganizationCredential, error) {
+	if !IsKnownProvider(provider) {
+		return models.OrganizationCredential{}, ErrUnknownProvider
+	}
+	if !IsKnownModel(provider, req.Model) {
+		return models.OrganizationCredential{}, ErrUnknownModel
+	}
+
+	sealed, err := s.encryptor.Seal(req.APIKey, orgCredentialContext(orgID, provider))
+	if err != nil {
+		return models.OrganizationCredential{}, err
+	}
+
+	var credential models.OrganizationCredential
+	err = s.db.Where("organization_id = ? AND provider = ?", orgID, provider).First(&credential).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.OrganizationCredential{}, err
+	}
+
+	credential.OrganizationID = orgID
+	credential.Provider = provider
+	credential.Key = sealed
+	credential.KeyHint = keyHint(req.APIKey)
+	credential.Model = req.Model
+	if err := s.db.Save(&credential).Error; err != nil {
+		return models.OrganizationCredential{}, err
+	}
+	return credential, nil
+}
+
+// ListCredentials returns the organization's provider credentials without their keys
+func (s *OrganizationService) ListCredentials(orgID uint) ([]models.OrganizationCredential, error) {
+	var credentials []models.OrganizationCredential
+	err := s.db.Where("organization_id = ?", orgID).Order("provider").Find(&credentials).Error
+	return credentials, err
+}
+
+// DeleteCredential removes the organization's API key for a provider
+func (s *OrganizationService) DeleteCredential(orgID uint, provider string) error {
+	result := s.db.Where("organization_id = ? AND provider = ?", orgID, provider).Delete(&models.OrganizationCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// orgCredentialContext binds an encrypted key to its organization and provider so it
+// cannot be copied to another row
+func orgCredentialContext(orgID uint, provider string) string {
+	return fmt.Sprintf("organization_credential:%d:%s", orgID, provider)
+}
+
+// plaintextOrgCredential is a row of organization_credentials from before keys were
+// encrypted
+type plaintextOrgCredential struct {
+	models.OrganizationCredential
+	APIKey string
+}
+
+func (plaintextOrgCredential) TableName() string {
+	return "organization_credentials"
+}
+
+// SealOrganizationCredentials encrypts the API keys organizations stored in plaintext
+// and drops the plaintext column. It has to run before the table is migrated: the new
+// columns cannot be added to a table that already has rows. Nothing is changed unless
+// every key could be sealed, so a missing encryption key leaves the table as it was.
+func SealOrganizationCredentials(db *gorm.DB, encryptor *Encryptor) error {
+	if !db.Migrator().HasColumn(&plaintextOrgCredential{}, "api_key") {
+		return nil
+	}
+
+	var rows []plaintextOrgCredential
+	if err := db.Find(&rows).Error; err != nil {
+		return err
+	}
+	credentials := make([]models.OrganizationCredential, len(rows))
+	for i, row := range rows {
+		sealed, err := encryptor.Seal(row.APIKey, orgCredentialContext(row.OrganizationID, row.Provider))
+		if err != nil {
+			return fmt.Errorf("failed to encrypt %s key of organization %d: %w", row.Provider, row.OrganizationID, err)
+		}
+		credentials[i] = row.OrganizationCredential
+		credentials[i].Key = sealed
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Migrator().DropTable(&models.OrganizationCredential{}); err != nil {
+			return err
+		}
+		if err := tx.AutoMigrate(&models.OrganizationCredential{}); err != nil {
+			return err
+		}
+		if len(credentials) == 0 {
+			return nil
+		}
+		return tx.Create(&credentials).Error
+	})
+}
+
+// AIServiceFor returns the AI service for a request made by a user in an organization.
+// provider and model come from the request or the user's preferences; an empty provider
+// means the organization's provider, then the server's. The user's own key for the
+// provider is preferred, then the organization's, then the server's keys, if any.
+func (s *OrganizationService) AIServiceFor(org models.Organization, userID uint, base *AIService, provider string, model string) (*AIService, error) {
+	if provider == "" {
+		provider = org.AIProvider
+	}
+	if provider == "" {
+		provider = base.ProviderName()
+	}
+	if !IsKnownProvider(provider) {
+		return nil, ErrUnknownProvider
+	}
+	if !IsKnownModel(provider, model) {
+		return nil, ErrUnknownModel
+	}
+
+	userKey, userModel, ok, err := s.userCredentials.Key(userID, provider)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		if model == "" {
+			model = userModel
+		}
+		if !IsKnownModel(provider, model) {
+			return nil, ErrUnknownModel
+		}
+		return base.WithCredentials(provider, userKey, model), nil
+	}
+
+	var credential models.OrganizationCredential
+	err = s.db.Where("organization_id = ? AND provider = ?", org.ID, provider).First(&credential).Error
+	switch {
+	case err == nil:
+		if model == "" {
+			model = credential.Model
+		}
+		if !IsKnownModel(provider, model) {
+			return nil, ErrUnknownModel
+		}
+		apiKey, err := s.encryptor.Open(credential.Key, orgCredentialContext(org.ID, provider))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s key %s of organization %d: %w", provider, credential.KeyHint, org.ID, err)
+		}
+		return base.WithCredentials(provider, apiKey, model), nil
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, err
+	case !base.HasServerKeys(provider):
+		return nil, ErrMissingCredential
+	case provider == base.ProviderName() && model == "":
+		return base, nil
+	default:
+		return base.WithProvider(provider, model), nil
+	}
+}
+
+// ReserveUsage counts a request against the organization's monthly quota before it is
+// made, failing with ErrQuotaExceeded when the quota is used up. Checking and reserving
+// is a single statement, so concurrent requests cannot both take the last one. The
+// reservation is then either completed with CompleteUsage or given back with RefundUsage.
+func (s *OrganizationService) ReserveUsage(org models.Organization, userID uint) (models.UsageRecord, error) {
+	record := models.UsageRecord{
+		OrganizationID: org.ID,
+		UserID:         userID,
+		Kind:           models.UsageKindReserved,
+		CreatedAt:      time.Now(),
+	}
+	if org.MonthlyRequestQuota == 0 {
+		return record, s.db.Create(&record).Error
+	}
+
+	err := s.db.Raw(`INSERT INTO usage_records (organization_id, user_id, kind, provider, created_at)
+		SELECT ?, ?, ?, '', ?
+		WHERE (SELECT COUNT(*) FROM usage_records WHERE organization_id = ? AND created_at >= ?) < ?
+		RETURNING id`,
+		record.OrganizationID, record.UserID, record.Kind, record.CreatedAt,
+		org.ID, startOfMonth(record.CreatedAt), org.MonthlyRequestQuota,
+	).Scan(&record.ID).Error
+	if err != nil {
+		return models.UsageRecord{}, err
+	}
+	if record.ID == 0 {
+		return models.UsageRecord{}, ErrQuotaExceeded
+	}
+	return record, nil
+}
+
+// CompleteUsage records what a reserved request turned out to be
+func (s *OrganizationService) CompleteUsage(record models.UsageRecord, kind string, provider string) error {
+	return s.db.Model(&models.UsageRecord{}).Where("id = ?", record.ID).
+		Updates(map[string]any{"kind": kind, "provider": provider}).Error
+}
+
+// RefundUsage gives back a reservation that was not completed, for requests that failed
+func (s *OrganizationService) RefundUsage(record models.UsageRecord) error {
+	return s.db.Where("id = ? AND kind = ?", record.ID, models.UsageKindReserved).Delete(&models.UsageRecord{}).Error
+}
+
+// Usage counts an organization's requests per kind between from and to
+func (s *OrganizationService) Usage(org models.Organization, from time.Time, to time.Time) (models.UsageSummary, error) {
+	var rows []struct {
+		Kind  string
+		Count int64
+	}
+	if err := s.db.Model(&models.UsageRecord{}).
+		Select("kind, COUNT(*) AS count").
+		Where("organization_id = ? AND created_at >= ? AND created_at < ?", org.ID, from, to).
+		Group("kind").Scan(&rows).Error; err != nil {
+		return models.UsageSummary{}, err
+	}
+
+	summary := models.UsageSummary{
+		OrganizationID: org.ID,
+		From:           from,
+		To:             to,
+		ByKind:         map[string]int64{},
+		Quota:          org.MonthlyRequestQuota,
+	}
+	for _, row := range rows {
+		summary.ByKind[row.Kind] = row.Count
+		summary.Total += row.Count
+	}
+	return summary, nil
+}
+
+// ensureAnotherOwner fails with ErrLastOwner unless someone other than userID owns the organization
+func ensureAnotherOwner(tx *gorm.DB, orgID uint, userID uint) error {
+	var owners int64
+	if err := tx.Model(&models.Membership{}).
+		Where("organization_id = ? AND role = ? AND user_id <> ?", orgID, models.OrgRoleOwner, userID).
+		Count(&owners).Error; err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// keyHint keeps the last four characters of a secret so users can tell keys apart
+func keyHint(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
+
+func startOfMonth(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+func translateOrgError(err error, notFound error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return notFound
+	}
+	return err
+}
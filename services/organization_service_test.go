@@ -0,0 +1,364 @@
+package services
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+	"sample-api/services/mailer"
+)
+
+func newTestOrganizationService(t *testing.T) (*OrganizationService, *UserService) {
+	t.Helper()
+
+	db := newTestDB(t)
+	users := NewUserService(db, config.AuthConfig{})
+	encryptor := newTestEncryptor(t, config.EncryptionConfig{Key: newMasterKey(t)})
+	orgs := NewOrganizationService(db, NewUserCredentialService(db, encryptor), encryptor, config.OrganizationsConfig{
+		InviteTTL: time.Hour,
+		InviteURL: "https://app.example.com/invites/accept?source=email",
+	}, config.MailConfig{Mailer: "log"})
+	return orgs, users
+}
+
+// newTestMember creates a user named after their email
+func newTestMember(t *testing.T, users *UserService, email string) models.User {
+	t.Helper()
+	user, err := users.CreateUser(models.User{Name: email, Email: email})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	return user
+}
+
+func TestOrganizationServiceReserveUsage(t *testing.T) {
+	orgs, users := newTestOrganizationService(t)
+	owner := newTestMember(t, users, "owner@example.com")
+	org, err := orgs.CreateOrganization(owner, "Acme")
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	if org, err = orgs.SetQuota(org, 5); err != nil {
+		t.Fatalf("SetQuota: %v", err)
+	}
+
+	// More requests than the quota allows arrive at once
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		reservations []models.UsageRecord
+	)
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reservation, err := orgs.ReserveUsage(org, owner.ID)
+			if errors.Is(err, ErrQuotaExceeded) {
+				return
+			}
+			if err != nil {
+				t.Errorf("ReserveUsage: %v", err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			reservations = append(reservations, reservation)
+		}()
+	}
+	wg.Wait()
+	if len(reservations) != org.MonthlyRequestQuota {
+		t.Fatalf("%d requests reserved usage, want the quota of %d", len(reservations), org.MonthlyRequestQuota)
+	}
+
+	// A completed request keeps its share, a failed one gives it back
+	if err := orgs.CompleteUsage(reservations[0], models.UsageKindPrompt, "openai"); err != nil {
+		t.Fatalf("CompleteUsage: %v", err)
+	}
+	for _, reservation := range reservations[:2] {
+		if err := orgs.RefundUsage(reservation); err != nil {
+			t.Fatalf("RefundUsage: %v", err)
+		}
+	}
+	if _, err := orgs.ReserveUsage(org, owner.ID); err != nil {
+		t.Fatalf("ReserveUsage after a refund: %v", err)
+	}
+	if _, err := orgs.ReserveUsage(org, owner.ID); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("ReserveUsage error = %v, want %v", err, ErrQuotaExceeded)
+	}
+
+	usage, err := orgs.Usage(org, startOfMonth(time.Now()), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.ByKind[models.UsageKindPrompt] != 1 || usage.Total != 5 {
+		t.Errorf("usage = %+v, want 1 prompt of 5 requests", usage)
+	}
+}
+
+// captureMailer keeps sent messages instead of delivering them
+type captureMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *captureMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// inviteToken returns the token of the invite link last emailed to address
+func (m *captureMailer) inviteToken(t *testing.T, address string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != address {
+			continue
+		}
+		link := inviteLinkPattern.FindString(m.sent[i].Body)
+		parsed, err := url.Parse(link)
+		if err != nil || parsed.Query().Get("source") != "email" {
+			t.Fatalf("invite link %q does not point at the configured page", link)
+		}
+		return parsed.Query().Get("token")
+	}
+	t.Fatalf("no invite was sent to %s", address)
+	return ""
+}
+
+var inviteLinkPattern = regexp.MustCompile(`https://app\.example\.com/invites/accept\?\S+`)
+
+// testOrganization is an organization with an owner, an admin and a member
+type testOrganization struct {
+	orgs                 *OrganizationService
+	users                *UserService
+	mail                 *captureMailer
+	org                  models.Organization
+	owner, admin, member models.User
+}
+
+func newTestOrganization(t *testing.T) testOrganization {
+	t.Helper()
+
+	orgs, users := newTestOrganizationService(t)
+	mail := &captureMailer{}
+	orgs.mailer = mail
+
+	o := testOrganization{orgs: orgs, users: users, mail: mail}
+	o.owner = newTestMember(t, users, "owner@example.com")
+	o.admin = newTestMember(t, users, "admin@example.com")
+	o.member = newTestMember(t, users, "member@example.com")
+
+	var err error
+	if o.org, err = orgs.CreateOrganization(o.owner, "Acme"); err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	for user, role := range map[*models.User]string{&o.admin: models.OrgRoleAdmin, &o.member: models.OrgRoleMember} {
+		if err := orgs.db.Create(&models.Membership{OrganizationID: o.org.ID, UserID: user.ID, Role: role}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+func TestOrganizationServiceResolve(t *testing.T) {
+	o := newTestOrganization(t)
+	outsider := newTestMember(t, o.users, "outsider@example.com")
+	siteAdmin, err := o.users.CreateUser(models.User{Name: "Site admin", Email: "root@example.com", Role: models.RoleAdmin})
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	orgID := strconv.FormatUint(uint64(o.org.ID), 10)
+
+	tests := []struct {
+		name     string
+		user     models.User
+		orgID    string
+		wantRole string
+		wantErr  error
+	}{
+		{name: "member", user: o.member, orgID: orgID, wantRole: models.OrgRoleMember},
+		{name: "owner", user: o.owner, orgID: orgID, wantRole: models.OrgRoleOwner},
+		{name: "outsider", user: outsider, orgID: orgID, wantErr: ErrOrganizationNotFound},
+		{name: "site admin", user: siteAdmin, orgID: orgID, wantRole: models.OrgRoleOwner},
+		{name: "unknown organization", user: o.member, orgID: "999", wantErr: ErrOrganizationNotFound},
+		{name: "malformed ID", user: o.member, orgID: "acme", wantErr: ErrOrganizationNotFound},
+		{name: "first organization by default", user: o.admin, wantRole: models.OrgRoleAdmin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			org, role, err := o.orgs.Resolve(tt.user, tt.orgID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (org.ID != o.org.ID || role != tt.wantRole) {
+				t.Errorf("Resolve = organization %d as %q, want %d as %q", org.ID, role, o.org.ID, tt.wantRole)
+			}
+		})
+	}
+
+	// Users without an organization get a workspace of their own
+	org, role, err := o.orgs.Resolve(outsider, "")
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if org.ID == o.org.ID || role != models.OrgRoleOwner {
+		t.Errorf("default organization = %d as %q, want a new one as owner", org.ID, role)
+	}
+}
+
+func TestOrganizationServiceUpdateMemberRole(t *testing.T) {
+	tests := []struct {
+		name string
+		// target and actor pick users of the test organization
+		target    func(o testOrganization) models.User
+		role      string
+		actorRole string
+		wantErr   error
+	}{
+		{name: "admin promotes a member", target: orgMember, role: models.OrgRoleAdmin, actorRole: models.OrgRoleAdmin},
+		{name: "admin cannot grant ownership", target: orgMember, role: models.OrgRoleOwner, actorRole: models.OrgRoleAdmin, wantErr: ErrOrgForbidden},
+		{name: "admin cannot demote an owner", target: orgOwner, role: models.OrgRoleMember, actorRole: models.OrgRoleAdmin, wantErr: ErrOrgForbidden},
+		{name: "owner grants ownership", target: orgAdmin, role: models.OrgRoleOwner, actorRole: models.OrgRoleOwner},
+		{name: "last owner cannot step down", target: orgOwner, role: models.OrgRoleAdmin, actorRole: models.OrgRoleOwner, wantErr: ErrLastOwner},
+		{name: "unknown member", target: func(testOrganization) models.User { return models.User{} }, role: models.OrgRoleAdmin, actorRole: models.OrgRoleOwner, wantErr: ErrMemberNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOrganization(t)
+			target := tt.target(o)
+
+			membership, err := o.orgs.UpdateMemberRole(o.org.ID, target.ID, tt.role, tt.actorRole)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdateMemberRole error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && membership.Role != tt.role {
+				t.Errorf("role = %q, want %q", membership.Role, tt.role)
+			}
+		})
+	}
+}
+
+func TestOrganizationServiceRemoveMember(t *testing.T) {
+	tests := []struct {
+		name      string
+		target    func(o testOrganization) models.User
+		actor     func(o testOrganization) models.User
+		actorRole string
+		wantErr   error
+	}{
+		{name: "member leaves", target: orgMember, actor: orgMember, actorRole: models.OrgRoleMember},
+		{name: "member cannot remove others", target: orgAdmin, actor: orgMember, actorRole: models.OrgRoleMember, wantErr: ErrOrgForbidden},
+		{name: "admin removes a member", target: orgMember, actor: orgAdmin, actorRole: models.OrgRoleAdmin},
+		{name: "admin cannot remove an owner", target: orgOwner, actor: orgAdmin, actorRole: models.OrgRoleAdmin, wantErr: ErrOrgForbidden},
+		{name: "last owner cannot leave", target: orgOwner, actor: orgOwner, actorRole: models.OrgRoleOwner, wantErr: ErrLastOwner},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOrganization(t)
+			target := tt.target(o)
+
+			err := o.orgs.RemoveMember(o.org.ID, target.ID, tt.actor(o), tt.actorRole)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RemoveMember error = %v, want %v", err, tt.wantErr)
+			}
+			_, _, resolveErr := o.orgs.Resolve(target, strconv.FormatUint(uint64(o.org.ID), 10))
+			if stillMember := resolveErr == nil; stillMember != (err != nil) {
+				t.Errorf("still a member = %v after RemoveMember error %v", stillMember, err)
+			}
+		})
+	}
+}
+
+func TestOrganizationServiceInvites(t *testing.T) {
+	o := newTestOrganization(t)
+	invitee := newTestMember(t, o.users, "invitee@example.com")
+	other := newTestMember(t, o.users, "other@example.com")
+
+	if _, err := o.orgs.CreateInvite(o.org, o.admin, models.CreateInviteRequest{Email: o.member.Email}); !errors.Is(err, ErrAlreadyMember) {
+		t.Fatalf("inviting a member: error = %v, want %v", err, ErrAlreadyMember)
+	}
+
+	invite, err := o.orgs.CreateInvite(o.org, o.admin, models.CreateInviteRequest{Email: invitee.Email, Role: models.OrgRoleAdmin})
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	token := o.mail.inviteToken(t, invitee.Email)
+
+	if _, err := o.orgs.AcceptInvite(other, token); !errors.Is(err, ErrInviteEmailMismatch) {
+		t.Fatalf("accepting someone else's invite: error = %v, want %v", err, ErrInviteEmailMismatch)
+	}
+	membership, err := o.orgs.AcceptInvite(invitee, token)
+	if err != nil {
+		t.Fatalf("AcceptInvite: %v", err)
+	}
+	if membership.OrganizationID != o.org.ID || membership.Role != models.OrgRoleAdmin {
+		t.Errorf("membership = %+v, want an admin of organization %d", membership, o.org.ID)
+	}
+	if _, err := o.orgs.AcceptInvite(invitee, token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("accepting twice: error = %v, want %v", err, ErrInvalidToken)
+	}
+	if err := o.orgs.RevokeInvite(o.org.ID, invite.ID); !errors.Is(err, ErrInviteNotFound) {
+		t.Errorf("revoking an accepted invite: error = %v, want %v", err, ErrInviteNotFound)
+	}
+
+	// Revoked and expired invites cannot be accepted
+	revoked, err := o.orgs.CreateInvite(o.org, o.admin, models.CreateInviteRequest{Email: other.Email})
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	revokedToken := o.mail.inviteToken(t, other.Email)
+	if err := o.orgs.RevokeInvite(o.org.ID, revoked.ID); err != nil {
+		t.Fatalf("RevokeInvite: %v", err)
+	}
+	if _, err := o.orgs.AcceptInvite(other, revokedToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("accepting a revoked invite: error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	expired, err := o.orgs.CreateInvite(o.org, o.admin, models.CreateInviteRequest{Email: other.Email})
+	if err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	expiredToken := o.mail.inviteToken(t, other.Email)
+	if err := o.orgs.db.Model(&expired).Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.orgs.AcceptInvite(other, expiredToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("accepting an expired invite: error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	pending, err := o.orgs.ListInvites(o.org.ID)
+	if err != nil {
+		t.Fatalf("ListInvites: %v", err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("pending invites = %+v, want none", pending)
+	}
+}
+
+func TestOrganizationServiceInvitesDisabled(t *testing.T) {
+	o := newTestOrganization(t)
+	o.orgs.inviteURL = ""
+
+	if _, err := o.orgs.CreateInvite(o.org, o.owner, models.CreateInviteRequest{Email: "invitee@example.com"}); !errors.Is(err, ErrInvitesDisabled) {
+		t.Fatalf("CreateInvite error = %v, want %v", err, ErrInvitesDisabled)
+	}
+	if len(o.mail.sent) != 0 {
+		t.Errorf("sent %d emails, want none", len(o.mail.sent))
+	}
+}
+
+func orgOwner(o testOrganization) models.User  { return o.owner }
+func orgAdmin(o testOrganization) models.User  { return o.admin }
+func orgMember(o testOrganization) models.User { return o.member }
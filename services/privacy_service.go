@@ -0,0 +1,261 @@
+package services
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"time"
+
+	"sample-api/models"
+
+	"gorm.io/gorm"
+)
+
+var ErrErasureNotConfirmed = errors.New("confirmation does not match the account's email address")
+
+// PrivacyService answers data subject requests: exporting everything stored about a
+// user and erasing it
+type PrivacyService struct {
+	db *gorm.DB
+}
+
+// NewPrivacyService creates a new privacy service
+func NewPrivacyService(db *gorm.DB) *PrivacyService {
+	return &PrivacyService{
+		db: db,
+	}
+}
+
+// exportSession is a refresh token as shown in an export, without its hash
+type exportSession struct {
+	ID        uint       `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// exportIdentity is a linked single sign-on account as shown in an export
+type exportIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// exportTranscript is the transcript kept for a media file as shown in an export
+type exportTranscript struct {
+	FileID     string             `json:"file_id"`
+	Filename   string             `json:"filename"`
+	Language   string             `json:"language,omitempty"` // language hint it was made with
+	Transcript *models.Transcript `json:"transcript"`
+}
+
+// Export writes a zip archive with one JSON file per kind of data held about the user
+func (s *PrivacyService) Export(userID uint, w io.Writer) error {
+	var user models.User
+	if err := s.db.First(&user, userID).Error; err != nil {
+		return translateUserError(err)
+	}
+
+	var (
+		memberships  []models.Membership
+		invites      []models.Invite
+		apiKeys      []models.APIKey
+		providerKeys []models.UserCredential
+		tokens       []models.RefreshToken
+		identities   []models.OIDCIdentity
+		usage        []models.UsageRecord
+		media        []models.MediaFile
+	)
+	queries := []struct {
+		dest  any
+		query *gorm.DB
+	}{
+		{&memberships, s.db.Preload("Organization").Where("user_id = ?", userID)},
+		{&invites, s.db.Where("LOWER(email) = ?", user.Email)},
+		{&apiKeys, s.db.Where("user_id = ?", userID)},
+		{&providerKeys, s.db.Where("user_id = ?", userID)},
+		{&tokens, s.db.Where("user_id = ?", userID)},
+		{&identities, s.db.Where("user_id = ?", userID)},
+		{&usage, s.db.Where("user_id = ?", userID)},
+		{&media, s.db.Where("owner_id = ?", userID)},
+	}
+	for _, q := range queries {
+		if err := q.query.Order("id").Find(q.dest).Error; err != nil {
+			return err
+		}
+	}
+
+	sessions := make([]exportSession, len(tokens))
+	for i, t := range tokens {
+		sessions[i] = exportSession{ID: t.ID, CreatedAt: t.CreatedAt, ExpiresAt: t.ExpiresAt, RevokedAt: t.RevokedAt}
+	}
+	linked := make([]exportIdentity, len(identities))
+	for i, identity := range identities {
+		linked[i] = exportIdentity{Issuer: identity.Issuer, Subject: identity.Subject, Email: identity.Email, CreatedAt: identity.CreatedAt}
+	}
+	transcripts := []exportTranscript{}
+	for _, file := range media {
+		if file.Transcript != nil {
+			transcripts = append(transcripts, exportTranscript{FileID: file.ID, Filename: file.Filename, Language: file.TranscriptLanguage, Transcript: file.Transcript})
+		}
+	}
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", user},
+		{"preferences.json", user.Preferences},
+		{"organizations.json", memberships},
+		{"invites.json", invites},
+		{"api_keys.json", apiKeys},
+		{"provider_keys.json", providerKeys},
+		{"sessions.json", sessions},
+		{"linked_accounts.json", linked},
+		{"usage.json", usage},
+		{"media.json", media},
+		{"transcripts.json", transcripts},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.name, err)
+		}
+	}
+	return archive.Close()
+}
+
+// Erase permanently deletes a user and everything that identifies them: credentials,
+// sessions, linked accounts, memberships, invites and media files. Usage records are
+// kept for organization billing but no longer point at the user. Organizations the
+// user was the only member of are deleted; if others remain, someone else must own
+// them first. An audit record of the erasure is kept.
+func (s *PrivacyService) Erase(userID uint, actorID uint, confirm string) (models.AuditRecord, error) {
+	var (
+		record     models.AuditRecord
+		mediaPaths []string
+	)
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Unscoped().First(&user, userID).Error; err != nil {
+			return translateUserError(err)
+		}
+		if models.NormalizeEmail(user.Email) != confirm {
+			return ErrErasureNotConfirmed
+		}
+
+		details := map[string]int64{}
+
+		var memberships []models.Membership
+		if err := tx.Where("user_id = ?", userID).Find(&memberships).Error; err != nil {
+			return err
+		}
+		for _, membership := range memberships {
+			var others int64
+			if err := tx.Model(&models.Membership{}).
+				Where("organization_id = ? AND user_id <> ?", membership.OrganizationID, userID).
+				Count(&others).Error; err != nil {
+				return err
+			}
+			if others > 0 {
+				if membership.Role == models.OrgRoleOwner {
+					if err := ensureAnotherOwner(tx, membership.OrganizationID, userID); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := deleteOrganization(tx, membership.OrganizationID); err != nil {
+				return err
+			}
+			details["organizations"]++
+		}
+
+		var media []models.MediaFile
+		if err := tx.Where("owner_id = ?", userID).Find(&media).Error; err != nil {
+			return err
+		}
+		for _, file := range media {
+			mediaPaths = append(mediaPaths, file.Path)
+		}
+
+		deletes := []struct {
+			name  string
+			model any
+			query string
+			args  []any
+		}{
+			{"memberships", &models.Membership{}, "user_id = ?", []any{userID}},
+			{"invites", &models.Invite{}, "LOWER(email) = ?", []any{models.NormalizeEmail(user.Email)}},
+			{"api_keys", &models.APIKey{}, "user_id = ?", []any{userID}},
+			{"provider_keys", &models.UserCredential{}, "user_id = ?", []any{userID}},
+			{"sessions", &models.RefreshToken{}, "user_id = ?", []any{userID}},
+			{"email_tokens", &models.UserToken{}, "user_id = ?", []any{userID}},
+			{"linked_accounts", &models.OIDCIdentity{}, "user_id = ?", []any{userID}},
+			{"media_files", &models.MediaFile{}, "owner_id = ?", []any{userID}},
+		}
+		for _, d := range deletes {
+			result := tx.Where(d.query, d.args...).Delete(d.model)
+			if result.Error != nil {
+				return result.Error
+			}
+			details[d.name] = result.RowsAffected
+		}
+
+		// Keep other members' records intact but drop the link to the erased user
+		if err := tx.Model(&models.Invite{}).Where("invited_by_id = ?", userID).Update("invited_by_id", 0).Error; err != nil {
+			return err
+		}
+		result := tx.Model(&models.UsageRecord{}).Where("user_id = ?", userID).Update("user_id", 0)
+		if result.Error != nil {
+			return result.Error
+		}
+		details["usage_records_anonymized"] = result.RowsAffected
+
+		if err := tx.Unscoped().Delete(&models.User{}, userID).Error; err != nil {
+			return err
+		}
+
+		record = models.AuditRecord{
+			Action:    models.AuditActionUserErased,
+			ActorID:   actorID,
+			SubjectID: userID,
+			Details:   details,
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return models.AuditRecord{}, err
+	}
+
+	// Files are removed once the erasure is committed; the janitor cannot find them anymore
+	for _, path := range mediaPaths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			slog.Warn("Failed to remove media file of erased user", "user_id", userID, "error", err)
+		}
+	}
+	return record, nil
+}
+
+// deleteOrganization removes an organization and everything that belongs to it
+func deleteOrganization(tx *gorm.DB, orgID uint) error {
+	for _, model := range []any{&models.Invite{}, &models.OrganizationCredential{}, &models.UsageRecord{}, &models.Membership{}} {
+		if err := tx.Where("organization_id = ?", orgID).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	return tx.Delete(&models.Organization{}, orgID).Error
+}
@@ -0,0 +1,245 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"sample-api/config"
+	"sample-api/models"
+)
+
+// testSubject is a member of a shared organization with data of every kind
+type testSubject struct {
+	testOrganization
+	privacy   *PrivacyService
+	workspace models.Organization
+	media     models.MediaFile
+	// secrets must never appear in an export
+	secrets []string
+}
+
+func newTestSubject(t *testing.T) testSubject {
+	t.Helper()
+
+	o := newTestOrganization(t)
+	db := o.orgs.db
+	s := testSubject{testOrganization: o, privacy: NewPrivacyService(db)}
+	user := o.member
+
+	var err error
+	if s.workspace, err = o.orgs.CreateOrganization(user, "Solo"); err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+
+	password := "member password"
+	if err := NewAuthService(db, o.users, config.AuthConfig{JWTSecret: "test-jwt-secret", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}).
+		SetPassword(user.ID, password); err != nil {
+		t.Fatalf("SetPassword: %v", err)
+	}
+	session, err := NewAuthService(db, o.users, config.AuthConfig{JWTSecret: "test-jwt-secret", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour}).
+		LoginUser(user)
+	if err != nil {
+		t.Fatalf("LoginUser: %v", err)
+	}
+	_, apiKey, err := NewAPIKeyService(db, o.users).Create(user.ID, "ci", []string{ScopeAI})
+	if err != nil {
+		t.Fatalf("create API key: %v", err)
+	}
+	if _, err := o.orgs.userCredentials.Set(user.ID, "openai", models.SetCredentialRequest{APIKey: "sk-member-provider-key"}); err != nil {
+		t.Fatalf("set provider key: %v", err)
+	}
+	if err := db.Create(&models.OIDCIdentity{UserID: user.ID, Issuer: "https://idp.example.com", Subject: "member-subject", Email: user.Email}).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, org := range []models.Organization{o.org, s.workspace} {
+		reservation, err := o.orgs.ReserveUsage(org, user.ID)
+		if err != nil {
+			t.Fatalf("ReserveUsage: %v", err)
+		}
+		if err := o.orgs.CompleteUsage(reservation, models.UsageKindTranscribe, "openai"); err != nil {
+			t.Fatalf("CompleteUsage: %v", err)
+		}
+	}
+
+	media := NewMediaService(db, config.MediaConfig{FileLinkSecret: "test-link-secret", FileLinkTTL: time.Hour})
+	path := filepath.Join(t.TempDir(), "audio.mp3")
+	if err := os.WriteFile(path, []byte("audio"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if s.media, err = media.Register(path, "audio.mp3", "audio/mpeg", user.ID, o.org.ID); err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if err := media.SaveTranscript(s.media, "en", &models.Transcript{Text: "hello from the member", Language: "en"}); err != nil {
+		t.Fatalf("SaveTranscript: %v", err)
+	}
+
+	stored, err := o.users.GetUser(user.ID)
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	s.secrets = []string{password, stored.PasswordHash, session.RefreshToken, hashToken(session.RefreshToken),
+		apiKey, hashToken(apiKey), "sk-member-provider-key"}
+	return s
+}
+
+// readExport returns the contents of each file in an export archive
+func readExport(t *testing.T, archive []byte) map[string][]byte {
+	t.Helper()
+
+	reader, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("export is not a zip archive: %v", err)
+	}
+	files := map[string][]byte{}
+	for _, file := range reader.File {
+		f, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[file.Name] = data
+	}
+	return files
+}
+
+func TestPrivacyServiceExport(t *testing.T) {
+	s := newTestSubject(t)
+	// Data of other users must stay out of the export
+	if _, err := s.orgs.CreateOrganization(s.owner, "Owner's other organization"); err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+
+	var archive bytes.Buffer
+	if err := s.privacy.Export(s.member.ID, &archive); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	files := readExport(t, archive.Bytes())
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	want := []string{"api_keys.json", "invites.json", "linked_accounts.json", "media.json", "organizations.json",
+		"preferences.json", "profile.json", "provider_keys.json", "sessions.json", "transcripts.json", "usage.json"}
+	if !slices.Equal(names, want) {
+		t.Fatalf("export files = %v, want %v", names, want)
+	}
+
+	counts := map[string]int{"api_keys.json": 1, "linked_accounts.json": 1, "media.json": 1, "organizations.json": 2,
+		"provider_keys.json": 1, "sessions.json": 1, "transcripts.json": 1, "usage.json": 2, "invites.json": 0}
+	for name, want := range counts {
+		var items []json.RawMessage
+		if err := json.Unmarshal(files[name], &items); err != nil {
+			t.Errorf("%s is not a JSON list: %v", name, err)
+			continue
+		}
+		if len(items) != want {
+			t.Errorf("%s has %d entries, want %d", name, len(items), want)
+		}
+	}
+
+	var transcripts []struct {
+		FileID     string            `json:"file_id"`
+		Transcript models.Transcript `json:"transcript"`
+	}
+	if err := json.Unmarshal(files["transcripts.json"], &transcripts); err == nil && len(transcripts) == 1 {
+		if transcripts[0].FileID != s.media.ID || transcripts[0].Transcript.Text != "hello from the member" {
+			t.Errorf("transcripts.json = %+v, want the member's transcript", transcripts)
+		}
+	}
+
+	for name, data := range files {
+		for _, secret := range s.secrets {
+			if strings.Contains(string(data), secret) {
+				t.Errorf("%s contains the secret %q", name, secret)
+			}
+		}
+	}
+}
+
+func TestPrivacyServiceErase(t *testing.T) {
+	s := newTestSubject(t)
+	db := s.orgs.db
+
+	if _, err := s.privacy.Erase(s.member.ID, s.owner.ID, "someone@example.com"); !errors.Is(err, ErrErasureNotConfirmed) {
+		t.Fatalf("Erase with the wrong confirmation: error = %v, want %v", err, ErrErasureNotConfirmed)
+	}
+	if _, err := s.users.GetUser(s.member.ID); err != nil {
+		t.Fatalf("user is gone after a refused erasure: %v", err)
+	}
+
+	record, err := s.privacy.Erase(s.member.ID, s.owner.ID, s.member.Email)
+	if err != nil {
+		t.Fatalf("Erase: %v", err)
+	}
+	if record.Action != models.AuditActionUserErased || record.ActorID != s.owner.ID || record.SubjectID != s.member.ID {
+		t.Errorf("audit record = %+v, want an erasure of %d by %d", record, s.member.ID, s.owner.ID)
+	}
+	wantDetails := map[string]int64{"organizations": 1, "memberships": 1, "api_keys": 1, "provider_keys": 1, "sessions": 1,
+		"linked_accounts": 1, "media_files": 1, "usage_records_anonymized": 1}
+	for name, want := range wantDetails {
+		if record.Details[name] != want {
+			t.Errorf("details[%q] = %d, want %d (all details: %v)", name, record.Details[name], want, record.Details)
+		}
+	}
+
+	var remaining int64
+	if err := db.Unscoped().Model(&models.User{}).Where("id = ?", s.member.ID).Count(&remaining).Error; err != nil {
+		t.Fatal(err)
+	}
+	if remaining != 0 {
+		t.Error("the erased user is still stored")
+	}
+	for _, model := range []any{&models.Membership{}, &models.APIKey{}, &models.UserCredential{}, &models.RefreshToken{},
+		&models.OIDCIdentity{}, &models.UsageRecord{}} {
+		if err := db.Model(model).Where("user_id = ?", s.member.ID).Count(&remaining).Error; err != nil {
+			t.Fatal(err)
+		}
+		if remaining != 0 {
+			t.Errorf("%T rows of the erased user remain", model)
+		}
+	}
+	if _, err := os.Stat(s.media.Path); !os.IsNotExist(err) {
+		t.Errorf("media file still on disk: %v", err)
+	}
+
+	// The workspace only the member belonged to is gone, the shared organization keeps
+	// its usage without knowing who made it
+	if _, _, err := s.orgs.Resolve(s.owner, strconv.FormatUint(uint64(s.workspace.ID), 10)); !errors.Is(err, ErrOrganizationNotFound) {
+		t.Errorf("the erased user's workspace still exists: %v", err)
+	}
+	usage, err := s.orgs.Usage(s.org, startOfMonth(time.Now()), time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Usage: %v", err)
+	}
+	if usage.Total != 1 {
+		t.Errorf("shared organization usage = %d, want 1", usage.Total)
+	}
+}
+
+func TestPrivacyServiceEraseLastOwner(t *testing.T) {
+	s := newTestSubject(t)
+
+	// The owner shares their organization with others, who would be left without an owner
+	if _, err := s.privacy.Erase(s.owner.ID, s.owner.ID, s.owner.Email); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("Erase error = %v, want %v", err, ErrLastOwner)
+	}
+	if _, err := s.users.GetUser(s.owner.ID); err != nil {
+		t.Fatalf("owner is gone after a refused erasure: %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package services
+
+import "os/exec"
+
+// killProcessGroup leaves cmd as is; only the process itself is killed when its context is done
+func killProcessGroup(cmd *exec.Cmd) {}
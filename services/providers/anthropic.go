@@ -2,11 +2,13 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 )
 
 // Anthropic API request/response structures
@@ -27,6 +29,10 @@ type AnthropicResponse struct {
 		Type string `json:"type"`
 		Text string `json:"text"`
 	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
 	Error struct {
 		Type    string `json:"type"`
 		Message string `json:"message"`
@@ -40,7 +46,14 @@ type AnthropicProvider struct {
 }
 
 // PromptAI sends a prompt to Anthropic API
-func (ap *AnthropicProvider) PromptAI(prompt string) (string, error) {
+func (ap *AnthropicProvider) PromptAI(ctx context.Context, prompt string) (string, error) {
+	start := time.Now()
+	response, err := ap.sendPrompt(ctx, prompt)
+	observeCall("anthropic", ap.ModelName, "prompt", start, err)
+	return response, err
+}
+
+func (ap *AnthropicProvider) sendPrompt(ctx context.Context, prompt string) (string, error) {
 	if prompt == "" {
 		return "", fmt.Errorf("prompt cannot be empty")
 	}
@@ -52,7 +65,7 @@ func (ap *AnthropicProvider) PromptAI(prompt string) (string, error) {
 	// Create request payload
 	reqPayload := AnthropicRequest{
 		Model:     ap.ModelName,
-		MaxTokens: 1000,
+		MaxTokens: MaxOutputTokens,
 		Messages: []AnthropicMessage{
 			{
 				Role:    "user",
@@ -68,7 +81,7 @@ func (ap *AnthropicProvider) PromptAI(prompt string) (string, error) {
 	}
 
 	// Make HTTP request
-	req, err := http.NewRequest("POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.anthropic.com/v1/messages", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -91,16 +104,16 @@ func (ap *AnthropicProvider) PromptAI(prompt string) (string, error) {
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Parse response
+	// Parse response; error responses are not always JSON
 	var anthropicResp AnthropicResponse
 	err = json.Unmarshal(body, &anthropicResp)
-	if err != nil {
+	if err != nil && resp.StatusCode < http.StatusBadRequest {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	// Check for errors
-	if anthropicResp.Error.Message != "" {
-		return "", fmt.Errorf("Anthropic API error: %s", anthropicResp.Error.Message)
+	if resp.StatusCode >= http.StatusBadRequest || anthropicResp.Error.Message != "" {
+		return "", &APIError{Provider: "Anthropic", StatusCode: resp.StatusCode, Type: anthropicResp.Error.Type, Message: anthropicResp.Error.Message}
 	}
 
 	if len(anthropicResp.Content) == 0 {
@@ -108,7 +121,18 @@ func (ap *AnthropicProvider) PromptAI(prompt string) (string, error) {
 	}
 
 	response := anthropicResp.Content[0].Text
-	log.Printf("Anthropic API called with model: %s", ap.ModelName)
+	countTokens("anthropic", ap.ModelName, anthropicResp.Usage.InputTokens, anthropicResp.Usage.OutputTokens)
+	slog.InfoContext(ctx, "AI provider called", "provider", "anthropic", "model", ap.ModelName)
 
 	return response, nil
 }
+
+// ContextWindow returns the context window of the configured model
+func (ap *AnthropicProvider) ContextWindow() int {
+	return contextWindowFor(ap.ModelName)
+}
+
+// EstimateTokens approximates the token count of text (~3.5 characters per token)
+func (ap *AnthropicProvider) EstimateTokens(text string) int {
+	return estimateTokens(text, 3.5)
+}
@@ -0,0 +1,51 @@
+package providers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// APIError is an error response from a provider's API
+type APIError struct {
+	Provider   string
+	StatusCode int
+	// Type is the provider's error type or status, e.g. "rate_limit_error" or "RESOURCE_EXHAUSTED"
+	Type    string
+	Message string
+}
+
+func (e *APIError) Error() string {
+	message := e.Message
+	if message == "" {
+		message = fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("%s API error: %s", e.Provider, message)
+}
+
+// RateLimited reports whether the key was throttled or ran out of quota
+func (e *APIError) RateLimited() bool {
+	if e.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	switch strings.ToLower(e.Type) {
+	case "rate_limit_error", "insufficient_quota", "resource_exhausted":
+		return true
+	}
+	return false
+}
+
+// Unauthorized reports whether the key itself was rejected, e.g. because it has been
+// revoked. Permission errors (403) are not included: providers also return them for a
+// model the key may not use, which says nothing about the key's other requests.
+func (e *APIError) Unauthorized() bool {
+	if e.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	switch strings.ToLower(e.Type) {
+	case "authentication_error", "invalid_api_key", "unauthenticated":
+		return true
+	}
+	// Google reports an invalid key as a bad request
+	return strings.Contains(e.Message, "API key not valid")
+}
@@ -2,11 +2,14 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 // Google AI API request/response structures
@@ -33,10 +36,15 @@ type GoogleAICandidate struct {
 }
 
 type GoogleAIResponse struct {
-	Candidates []GoogleAICandidate `json:"candidates"`
-	Error      struct {
+	Candidates    []GoogleAICandidate `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+	} `json:"usageMetadata"`
+	Error struct {
 		Code    int    `json:"code"`
 		Message string `json:"message"`
+		Status  string `json:"status"`
 	} `json:"error"`
 }
 
@@ -47,7 +55,14 @@ type GoogleAIProvider struct {
 }
 
 // PromptAI sends a prompt to Google AI API
-func (gp *GoogleAIProvider) PromptAI(prompt string) (string, error) {
+func (gp *GoogleAIProvider) PromptAI(ctx context.Context, prompt string) (string, error) {
+	start := time.Now()
+	response, err := gp.sendPrompt(ctx, prompt)
+	observeCall("google", gp.ModelName, "prompt", start, err)
+	return response, err
+}
+
+func (gp *GoogleAIProvider) sendPrompt(ctx context.Context, prompt string) (string, error) {
 	if prompt == "" {
 		return "", fmt.Errorf("prompt cannot be empty")
 	}
@@ -70,7 +85,7 @@ func (gp *GoogleAIProvider) PromptAI(prompt string) (string, error) {
 	}
 
 	reqPayload.GenerationConfig.Temperature = 0.7
-	reqPayload.GenerationConfig.MaxOutputTokens = 1000
+	reqPayload.GenerationConfig.MaxOutputTokens = MaxOutputTokens
 
 	// Convert to JSON
 	jsonData, err := json.Marshal(reqPayload)
@@ -79,14 +94,15 @@ func (gp *GoogleAIProvider) PromptAI(prompt string) (string, error) {
 	}
 
 	// Make HTTP request
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/%s:generateContent?key=%s", gp.ModelName, gp.APIKey)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	endpoint := fmt.Sprintf("https://generativelanguage.googleapis.com/v1/models/%s:generateContent", url.PathEscape(gp.ModelName))
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
 
-	// Set headers
+	// Set headers; the key goes in a header so it never shows up in URLs in errors or logs
 	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-goog-api-key", gp.APIKey)
 
 	// Send request
 	client := &http.Client{}
@@ -102,16 +118,16 @@ func (gp *GoogleAIProvider) PromptAI(prompt string) (string, error) {
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Parse response
+	// Parse response; error responses are not always JSON
 	var googleResp GoogleAIResponse
 	err = json.Unmarshal(body, &googleResp)
-	if err != nil {
+	if err != nil && resp.StatusCode < http.StatusBadRequest {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	// Check for errors
-	if googleResp.Error.Message != "" {
-		return "", fmt.Errorf("Google AI error: %s", googleResp.Error.Message)
+	if resp.StatusCode >= http.StatusBadRequest || googleResp.Error.Message != "" {
+		return "", &APIError{Provider: "Google AI", StatusCode: resp.StatusCode, Type: googleResp.Error.Status, Message: googleResp.Error.Message}
 	}
 
 	if len(googleResp.Candidates) == 0 {
@@ -123,7 +139,18 @@ func (gp *GoogleAIProvider) PromptAI(prompt string) (string, error) {
 	}
 
 	response := googleResp.Candidates[0].Content.Parts[0].Text
-	log.Printf("Google AI API called with model: %s", gp.ModelName)
+	countTokens("google", gp.ModelName, googleResp.UsageMetadata.PromptTokenCount, googleResp.UsageMetadata.CandidatesTokenCount)
+	slog.InfoContext(ctx, "AI provider called", "provider", "google", "model", gp.ModelName)
 
 	return response, nil
 }
+
+// ContextWindow returns the context window of the configured model
+func (gp *GoogleAIProvider) ContextWindow() int {
+	return contextWindowFor(gp.ModelName)
+}
+
+// EstimateTokens approximates the token count of text (~4 characters per token)
+func (gp *GoogleAIProvider) EstimateTokens(text string) int {
+	return estimateTokens(text, 4.0)
+}
@@ -1,6 +1,31 @@
 package providers
 
+import "context"
+
 // AIProvider defines the interface for AI platform providers
 type AIProvider interface {
-	PromptAI(prompt string) (string, error)
+	PromptAI(ctx context.Context, prompt string) (string, error)
+	// ContextWindow returns the number of tokens the configured model accepts per request
+	ContextWindow() int
+	// EstimateTokens approximates how many tokens text uses with the configured model
+	EstimateTokens(text string) int
+}
+
+// Transcriber is implemented by providers that support speech-to-text
+type Transcriber interface {
+	TranscribeAudio(ctx context.Context, audioPath string, language string) (*Transcription, error)
+}
+
+// Transcription is the result of transcribing one audio file
+type Transcription struct {
+	Text     string
+	Language string
+	Segments []TranscriptionSegment
+}
+
+// TranscriptionSegment is a piece of speech with timestamps in seconds relative to the file start
+type TranscriptionSegment struct {
+	Start float64
+	End   float64
+	Text  string
 }
@@ -0,0 +1,62 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"sample-api/metrics"
+)
+
+// transcriptionModels are the speech-to-text models labelled by name in metrics
+var transcriptionModels = []string{"whisper-1", "gpt-4o-transcribe", "gpt-4o-mini-transcribe"}
+
+// modelLabel maps a model to one of a fixed set of label values, so that clients picking
+// models cannot grow the metrics without bound. Models are labelled by the family they
+// belong to, e.g. "gpt-4o" for "gpt-4o-2024-08-06", and unknown ones as "other".
+func modelLabel(model string) string {
+	for _, name := range transcriptionModels {
+		if model == name {
+			return name
+		}
+	}
+	label := "other"
+	for prefix := range contextWindows {
+		if strings.HasPrefix(model, prefix) && (label == "other" || len(prefix) > len(label)) {
+			label = prefix
+		}
+	}
+	return label
+}
+
+// observeCall records the latency of a call to a provider's API and, if it failed, why
+func observeCall(provider string, model string, operation string, start time.Time, err error) {
+	model = modelLabel(model)
+	metrics.ProviderRequestDuration.WithLabelValues(provider, model, operation).Observe(time.Since(start).Seconds())
+	if err != nil {
+		metrics.ProviderErrors.WithLabelValues(provider, model, operation, errorReason(err)).Inc()
+	}
+}
+
+// countTokens records the token usage a provider reported for a call
+func countTokens(provider string, model string, input int, output int) {
+	model = modelLabel(model)
+	metrics.ProviderTokens.WithLabelValues(provider, model, "input").Add(float64(input))
+	metrics.ProviderTokens.WithLabelValues(provider, model, "output").Add(float64(output))
+}
+
+func errorReason(err error) string {
+	var apiErr *APIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.RateLimited():
+		return "rate_limited"
+	case errors.As(err, &apiErr) && apiErr.Unauthorized():
+		return "unauthorized"
+	case errors.As(err, &apiErr):
+		return "api_error"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "cancelled"
+	}
+	return "request_failed"
+}
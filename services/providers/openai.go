@@ -2,11 +2,13 @@ package providers
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"time"
 )
 
 // OpenAI API request/response structures
@@ -29,7 +31,11 @@ type OpenAIRequest struct {
 type OpenAIResponse struct {
 	ID      string         `json:"id"`
 	Choices []OpenAIChoice `json:"choices"`
-	Error   struct {
+	Usage   struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error struct {
 		Message string `json:"message"`
 		Type    string `json:"type"`
 	} `json:"error"`
@@ -37,12 +43,20 @@ type OpenAIResponse struct {
 
 // OpenAIProvider implements AIProvider for OpenAI
 type OpenAIProvider struct {
-	APIKey    string
-	ModelName string
+	APIKey             string
+	ModelName          string
+	TranscriptionModel string
 }
 
 // PromptAI sends a prompt to OpenAI API
-func (op *OpenAIProvider) PromptAI(prompt string) (string, error) {
+func (op *OpenAIProvider) PromptAI(ctx context.Context, prompt string) (string, error) {
+	start := time.Now()
+	response, err := op.sendPrompt(ctx, prompt)
+	observeCall("openai", op.ModelName, "prompt", start, err)
+	return response, err
+}
+
+func (op *OpenAIProvider) sendPrompt(ctx context.Context, prompt string) (string, error) {
 	if prompt == "" {
 		return "", fmt.Errorf("prompt cannot be empty")
 	}
@@ -61,7 +75,7 @@ func (op *OpenAIProvider) PromptAI(prompt string) (string, error) {
 			},
 		},
 		Temperature: 0.7,
-		MaxTokens:   1000,
+		MaxTokens:   MaxOutputTokens,
 	}
 
 	// Convert to JSON
@@ -71,7 +85,7 @@ func (op *OpenAIProvider) PromptAI(prompt string) (string, error) {
 	}
 
 	// Make HTTP request
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(jsonData))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
 	}
@@ -94,16 +108,16 @@ func (op *OpenAIProvider) PromptAI(prompt string) (string, error) {
 		return "", fmt.Errorf("failed to read response: %w", err)
 	}
 
-	// Parse response
+	// Parse response; error responses are not always JSON
 	var openaiResp OpenAIResponse
 	err = json.Unmarshal(body, &openaiResp)
-	if err != nil {
+	if err != nil && resp.StatusCode < http.StatusBadRequest {
 		return "", fmt.Errorf("failed to parse response: %w", err)
 	}
 
 	// Check for errors
-	if openaiResp.Error.Message != "" {
-		return "", fmt.Errorf("OpenAI API error: %s", openaiResp.Error.Message)
+	if resp.StatusCode >= http.StatusBadRequest || openaiResp.Error.Message != "" {
+		return "", &APIError{Provider: "OpenAI", StatusCode: resp.StatusCode, Type: openaiResp.Error.Type, Message: openaiResp.Error.Message}
 	}
 
 	if len(openaiResp.Choices) == 0 {
@@ -111,7 +125,18 @@ func (op *OpenAIProvider) PromptAI(prompt string) (string, error) {
 	}
 
 	response := openaiResp.Choices[0].Message.Content
-	log.Printf("OpenAI API called with model: %s", op.ModelName)
+	countTokens("openai", op.ModelName, openaiResp.Usage.PromptTokens, openaiResp.Usage.CompletionTokens)
+	slog.InfoContext(ctx, "AI provider called", "provider", "openai", "model", op.ModelName)
 
 	return response, nil
 }
+
+// ContextWindow returns the context window of the configured model
+func (op *OpenAIProvider) ContextWindow() int {
+	return contextWindowFor(op.ModelName)
+}
+
+// EstimateTokens approximates the token count of text (~4 characters per token)
+func (op *OpenAIProvider) EstimateTokens(text string) int {
+	return estimateTokens(text, 4.0)
+}
@@ -0,0 +1,132 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// OpenAITranscriptionResponse is the verbose_json response of the transcription API
+type OpenAITranscriptionResponse struct {
+	Text     string  `json:"text"`
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Segments []struct {
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	} `json:"segments"`
+	Error struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error"`
+}
+
+// TranscribeAudio sends an audio file to the OpenAI transcription API
+func (op *OpenAIProvider) TranscribeAudio(ctx context.Context, audioPath string, language string) (*Transcription, error) {
+	start := time.Now()
+	transcription, err := op.sendAudio(ctx, audioPath, language)
+	observeCall("openai", op.transcriptionModel(), "transcribe", start, err)
+	return transcription, err
+}
+
+func (op *OpenAIProvider) transcriptionModel() string {
+	if op.TranscriptionModel == "" {
+		return "whisper-1"
+	}
+	return op.TranscriptionModel
+}
+
+func (op *OpenAIProvider) sendAudio(ctx context.Context, audioPath string, language string) (*Transcription, error) {
+	if op.APIKey == "" {
+		return nil, fmt.Errorf("OpenAI API key not set")
+	}
+
+	file, err := os.Open(audioPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer file.Close()
+
+	// Build multipart form
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return nil, fmt.Errorf("failed to read audio file: %w", err)
+	}
+
+	model := op.transcriptionModel()
+	writer.WriteField("model", model)
+	writer.WriteField("response_format", "verbose_json")
+	writer.WriteField("timestamp_granularities[]", "segment")
+	if language != "" {
+		writer.WriteField("language", language)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	// Make HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/audio/transcriptions", &body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	// Set headers
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", op.APIKey))
+
+	// Send request
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call OpenAI API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	// Parse response
+	var transcriptionResp OpenAITranscriptionResponse
+	if err := json.Unmarshal(respBody, &transcriptionResp); err != nil && resp.StatusCode < http.StatusBadRequest {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	// Check for errors
+	if resp.StatusCode >= http.StatusBadRequest || transcriptionResp.Error.Message != "" {
+		return nil, &APIError{Provider: "OpenAI", StatusCode: resp.StatusCode, Type: transcriptionResp.Error.Type, Message: transcriptionResp.Error.Message}
+	}
+
+	transcription := &Transcription{
+		Text:     transcriptionResp.Text,
+		Language: transcriptionResp.Language,
+	}
+	for _, segment := range transcriptionResp.Segments {
+		transcription.Segments = append(transcription.Segments, TranscriptionSegment{
+			Start: segment.Start,
+			End:   segment.End,
+			Text:  segment.Text,
+		})
+	}
+	slog.InfoContext(ctx, "AI provider called", "provider", "openai", "model", model)
+
+	return transcription, nil
+}
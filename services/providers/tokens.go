@@ -0,0 +1,52 @@
+package providers
+
+import (
+	"math"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxOutputTokens is the completion budget every provider requests
+const MaxOutputTokens = 1000
+
+const defaultContextWindow = 8192
+
+// Context window sizes in tokens, matched by model name prefix (longest prefix wins)
+var contextWindows = map[string]int{
+	"gpt-3.5-turbo":    16385,
+	"gpt-4":            8192,
+	"gpt-4-32k":        32768,
+	"gpt-4-turbo":      128000,
+	"gpt-4o":           128000,
+	"gpt-4.1":          1047576,
+	"o1":               200000,
+	"o3":               200000,
+	"claude-2":         100000,
+	"claude-3":         200000,
+	"claude-sonnet-4":  200000,
+	"claude-opus-4":    200000,
+	"gemini-pro":       32760,
+	"gemini-1.0-pro":   32760,
+	"gemini-1.5-flash": 1048576,
+	"gemini-1.5-pro":   2097152,
+	"gemini-2":         1048576,
+}
+
+// contextWindowFor looks up the context window of a model by name prefix
+func contextWindowFor(model string) int {
+	window, matched := defaultContextWindow, 0
+	for prefix, size := range contextWindows {
+		if strings.HasPrefix(model, prefix) && len(prefix) > matched {
+			window, matched = size, len(prefix)
+		}
+	}
+	return window
+}
+
+// estimateTokens approximates the token count of text for tokenizers that average
+// charsPerToken characters per token, never estimating less than ~1.3 tokens per word
+func estimateTokens(text string, charsPerToken float64) int {
+	byChars := float64(utf8.RuneCountInString(text)) / charsPerToken
+	byWords := float64(len(strings.Fields(text))) * 1.3
+	return int(math.Ceil(math.Max(byChars, byWords)))
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"sample-api/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ErrInvalidQuery wraps problems with list query parameters supplied by the client
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ListQuery describes the pagination, sorting and filtering requested for a list endpoint
+type ListQuery struct {
+	Limit         int
+	Offset        int
+	Cursor        string
+	Sort          string // column name, prefixed with "-" for descending order
+	Filters       map[string]string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+// ListSpec declares which columns a list endpoint lets clients sort and search by
+type ListSpec struct {
+	SortColumns   []string          // allowlisted sort columns
+	DefaultSort   string            // used when the query has no sort, e.g. "-created_at"
+	SearchColumns map[string]string // filter name -> column matched by case-insensitive substring
+}
+
+// listCursor is the decoded form of an opaque keyset pagination cursor
+type listCursor struct {
+	Sort  string          `json:"s"`
+	Value json.RawMessage `json:"v"`
+	ID    uint            `json:"id"`
+}
+
+// Paginate runs a filtered, sorted and paginated query for T. Offset pagination is used
+// unless a cursor is given, in which case rows after the cursor position are returned.
+// The total count ignores pagination but honours filters.
+func Paginate[T any](db *gorm.DB, spec ListSpec, q ListQuery) (models.Page[T], error) {
+	page := models.Page[T]{Items: []T{}}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		limit = MaxPageLimit
+	}
+	page.Limit = limit
+
+	if q.Cursor != "" && q.Offset > 0 {
+		return page, fmt.Errorf("%w: cursor and offset cannot be combined", ErrInvalidQuery)
+	}
+
+	sort := q.Sort
+	if sort == "" {
+		sort = spec.DefaultSort
+	}
+	column, desc := strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+	if !slices.Contains(spec.SortColumns, column) {
+		return page, fmt.Errorf("%w: cannot sort by %q (allowed: %s)", ErrInvalidQuery, column, strings.Join(spec.SortColumns, ", "))
+	}
+
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return page, err
+	}
+	sortField := stmt.Schema.LookUpField(column)
+	if sortField == nil {
+		return page, fmt.Errorf("unknown sort column: %s", column)
+	}
+
+	// Filters
+	query := db.Model(new(T))
+	for name, value := range q.Filters {
+		searchColumn, ok := spec.SearchColumns[name]
+		if !ok || value == "" {
+			continue
+		}
+		query = query.Where("LOWER("+searchColumn+") LIKE ? ESCAPE '\\'", "%"+escapeLike(strings.ToLower(value))+"%")
+	}
+	if q.CreatedAfter != nil {
+		query = query.Where("created_at >= ?", *q.CreatedAfter)
+	}
+	if q.CreatedBefore != nil {
+		query = query.Where("created_at < ?", *q.CreatedBefore)
+	}
+
+	if err := query.Session(&gorm.Session{}).Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+
+	// Keyset condition for cursor pagination
+	direction, cmp := "ASC", ">"
+	if desc {
+		direction, cmp = "DESC", "<"
+	}
+	if q.Cursor != "" {
+		cursor, value, err := decodeCursor(q.Cursor, sort, sortField)
+		if err != nil {
+			return page, err
+		}
+		if column == "id" {
+			query = query.Where("id "+cmp+" ?", cursor.ID)
+		} else {
+			query = query.Where("("+column+" "+cmp+" ?) OR ("+column+" = ? AND id "+cmp+" ?)", value, value, cursor.ID)
+		}
+	} else {
+		query = query.Offset(q.Offset)
+		page.Offset = q.Offset
+	}
+
+	order := column + " " + direction
+	if column != "id" {
+		order += ", id " + direction
+	}
+
+	// Fetch one extra row to learn whether another page follows
+	var items []T
+	if err := query.Order(order).Limit(limit + 1).Find(&items).Error; err != nil {
+		return page, err
+	}
+
+	if len(items) > limit {
+		items = items[:limit]
+		next, err := encodeCursor(stmt.Schema, sort, sortField, items[len(items)-1])
+		if err != nil {
+			return page, err
+		}
+		page.NextCursor = next
+	}
+	page.Items = items
+
+	return page, nil
+}
+
+func encodeCursor(s *schema.Schema, sort string, sortField *schema.Field, last any) (string, error) {
+	ctx := context.Background()
+	row := reflect.ValueOf(last)
+
+	id, _ := s.PrioritizedPrimaryField.ValueOf(ctx, row)
+	value, _ := sortField.ValueOf(ctx, row)
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	idValue, ok := id.(uint)
+	if !ok {
+		return "", fmt.Errorf("cursor pagination requires a uint primary key")
+	}
+
+	data, err := json.Marshal(listCursor{Sort: sort, Value: raw, ID: idValue})
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor parses a cursor and converts its sort value back to the column's Go type
+func decodeCursor(encoded string, sort string, sortField *schema.Field) (listCursor, any, error) {
+	var cursor listCursor
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || json.Unmarshal(data, &cursor) != nil {
+		return cursor, nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if cursor.Sort != sort {
+		return cursor, nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidQuery)
+	}
+
+	value := reflect.New(sortField.IndirectFieldType)
+	if err := json.Unmarshal(cursor.Value, value.Interface()); err != nil {
+		return cursor, nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	return cursor, value.Elem().Interface(), nil
+}
+
+// escapeLike escapes LIKE wildcards so filter values match literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"sample-api/config"
+	"sample-api/models"
+)
+
+// newTestUsers creates users with the given names, in order, and returns the service
+func newTestUsers(t *testing.T, names ...string) *UserService {
+	t.Helper()
+	users := NewUserService(newTestDB(t), config.AuthConfig{})
+	for i, name := range names {
+		if _, err := users.CreateUser(models.User{Name: name, Email: fmt.Sprintf("user%d@example.com", i)}); err != nil {
+			t.Fatalf("CreateUser: %v", err)
+		}
+	}
+	return users
+}
+
+func userIDs(page models.Page[models.User]) []uint {
+	ids := []uint{}
+	for _, user := range page.Items {
+		ids = append(ids, user.ID)
+	}
+	return ids
+}
+
+func TestPaginateCursor(t *testing.T) {
+	// Duplicate names make the cursor rely on the id tie-breaker
+	users := newTestUsers(t, "carol", "alice", "bob", "alice", "dave", "bob", "alice")
+
+	tests := []struct {
+		sort string
+		want []uint
+	}{
+		{sort: "id", want: []uint{1, 2, 3, 4, 5, 6, 7}},
+		{sort: "-id", want: []uint{7, 6, 5, 4, 3, 2, 1}},
+		{sort: "name", want: []uint{2, 4, 7, 3, 6, 1, 5}},
+		{sort: "-name", want: []uint{5, 1, 6, 3, 7, 4, 2}},
+		// Timestamps survive the round trip through the cursor
+		{sort: "-created_at", want: []uint{7, 6, 5, 4, 3, 2, 1}},
+	}
+
+	for _, tt := range tests {
+		for _, limit := range []int{1, 2, 3, 7} {
+			t.Run(fmt.Sprintf("%s by %d", tt.sort, limit), func(t *testing.T) {
+				got := []uint{}
+				cursor := ""
+				for pages := 0; ; pages++ {
+					if pages > len(tt.want) {
+						t.Fatalf("cursor never ran out, got %v so far", got)
+					}
+					page, err := users.ListUsers(ListQuery{Limit: limit, Sort: tt.sort, Cursor: cursor})
+					if err != nil {
+						t.Fatalf("ListUsers: %v", err)
+					}
+					if page.Total != int64(len(tt.want)) {
+						t.Fatalf("total = %d, want %d", page.Total, len(tt.want))
+					}
+					got = append(got, userIDs(page)...)
+					if cursor = page.NextCursor; cursor == "" {
+						break
+					}
+				}
+				if !reflect.DeepEqual(got, tt.want) {
+					t.Errorf("pages = %v, want %v", got, tt.want)
+				}
+			})
+		}
+	}
+}
+
+func TestPaginateOffsetAndLimit(t *testing.T) {
+	names := make([]string, MaxPageLimit+5)
+	for i := range names {
+		names[i] = fmt.Sprintf("user %03d", i)
+	}
+	users := newTestUsers(t, names...)
+
+	tests := []struct {
+		name      string
+		query     ListQuery
+		wantLen   int
+		wantFirst uint
+		wantNext  bool
+	}{
+		{name: "default limit", query: ListQuery{}, wantLen: DefaultPageLimit, wantFirst: 1, wantNext: true},
+		{name: "limit is capped", query: ListQuery{Limit: MaxPageLimit + 50}, wantLen: MaxPageLimit, wantFirst: 1, wantNext: true},
+		{name: "offset", query: ListQuery{Limit: 10, Offset: 100}, wantLen: 5, wantFirst: 101},
+		{name: "offset past the end", query: ListQuery{Offset: 500}, wantLen: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := users.ListUsers(tt.query)
+			if err != nil {
+				t.Fatalf("ListUsers: %v", err)
+			}
+			if len(page.Items) != tt.wantLen {
+				t.Fatalf("got %d users, want %d", len(page.Items), tt.wantLen)
+			}
+			if tt.wantLen > 0 && page.Items[0].ID != tt.wantFirst {
+				t.Errorf("first user = %d, want %d", page.Items[0].ID, tt.wantFirst)
+			}
+			if (page.NextCursor != "") != tt.wantNext {
+				t.Errorf("next cursor = %q, want one: %v", page.NextCursor, tt.wantNext)
+			}
+			if page.Total != int64(len(names)) {
+				t.Errorf("total = %d, want %d", page.Total, len(names))
+			}
+		})
+	}
+}
+
+func TestPaginateFilters(t *testing.T) {
+	users := newTestUsers(t, "100% Alice", "1000 Bob", "alice_b", "aliceXb")
+
+	tests := []struct {
+		filter string
+		want   []uint
+	}{
+		{filter: "ALICE", want: []uint{1, 3, 4}},
+		// LIKE wildcards in the filter match literally
+		{filter: "100%", want: []uint{1}},
+		{filter: "e_b", want: []uint{3}},
+		{filter: "", want: []uint{1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			page, err := users.ListUsers(ListQuery{Filters: map[string]string{"name": tt.filter}})
+			if err != nil {
+				t.Fatalf("ListUsers: %v", err)
+			}
+			if got := userIDs(page); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("users = %v, want %v", got, tt.want)
+			}
+			if page.Total != int64(len(tt.want)) {
+				t.Errorf("total = %d, want %d", page.Total, len(tt.want))
+			}
+		})
+	}
+}
+
+func TestPaginateInvalidQuery(t *testing.T) {
+	users := newTestUsers(t, "alice", "bob", "carol")
+	first, err := users.ListUsers(ListQuery{Limit: 1, Sort: "name"})
+	if err != nil {
+		t.Fatalf("ListUsers: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query ListQuery
+	}{
+		{name: "sort column not allowed", query: ListQuery{Sort: "password_hash"}},
+		{name: "cursor with offset", query: ListQuery{Sort: "name", Cursor: first.NextCursor, Offset: 1}},
+		{name: "cursor for another sort", query: ListQuery{Sort: "-name", Cursor: first.NextCursor}},
+		{name: "malformed cursor", query: ListQuery{Sort: "name", Cursor: "not a cursor"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := users.ListUsers(tt.query); !errors.Is(err, ErrInvalidQuery) {
+				t.Fatalf("ListUsers error = %v, want %v", err, ErrInvalidQuery)
+			}
+		})
+	}
+}
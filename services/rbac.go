@@ -0,0 +1,47 @@
+package services
+
+import (
+	"slices"
+
+	"sample-api/models"
+)
+
+// Permission is an action a role may perform
+type Permission string
+
+const (
+	// PermUsersManage allows listing, creating, restoring and purging any user and changing roles
+	PermUsersManage Permission = "users:manage"
+	// PermAIUse allows calling the paid /ai endpoints
+	PermAIUse Permission = "ai:use"
+	// PermAudioExtract allows downloading and processing audio
+	PermAudioExtract Permission = "audio:extract"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleAdmin:  {PermUsersManage, PermAIUse, PermAudioExtract},
+	models.RoleMember: {PermAIUse, PermAudioExtract},
+	models.RoleViewer: {},
+}
+
+// HasPermission reports whether role grants permission
+func HasPermission(role string, permission Permission) bool {
+	return slices.Contains(rolePermissions[role], permission)
+}
+
+// CanAccess reports whether user may see a resource owned by ownerID.
+// Users can access their own resources; admins can access everything.
+func CanAccess(user models.User, ownerID uint) bool {
+	return user.Role == models.RoleAdmin || user.ID == ownerID
+}
+
+var orgRoleRank = map[string]int{
+	models.OrgRoleMember: 1,
+	models.OrgRoleAdmin:  2,
+	models.OrgRoleOwner:  3,
+}
+
+// HasOrgRole reports whether an organization role is at least minimum
+func HasOrgRole(role string, minimum string) bool {
+	return orgRoleRank[role] >= orgRoleRank[minimum]
+}
@@ -0,0 +1,22 @@
+package services
+
+import (
+	"crypto/rand"
+	"log/slog"
+	"os"
+)
+
+// signingSecret returns the configured secret for setting key. When it is not set a
+// random secret is generated, which means anything signed with it is invalid after a restart.
+func signingSecret(key string, value string) []byte {
+	if value != "" {
+		return []byte(value)
+	}
+	slog.Warn("Setting is not configured, using a random secret; signatures will not survive a restart", "setting", key)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		slog.Error("Failed to generate secret", "error", err)
+		os.Exit(1)
+	}
+	return secret
+}
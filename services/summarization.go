@@ -0,0 +1,215 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"sample-api/services/providers"
+)
+
+const (
+	SummaryStrategyStuff     = "stuff"
+	SummaryStrategyMapReduce = "map_reduce"
+
+	// promptOverheadTokens leaves room for the instructions wrapped around the text
+	promptOverheadTokens = 200
+	// maxReduceRounds bounds how often partial summaries are collapsed before giving up
+	maxReduceRounds = 3
+	// maxSummaryChunks bounds the prompts one summary may send in its map step
+	maxSummaryChunks = 50
+)
+
+var ErrContentTooLarge = errors.New("content is too long to summarize")
+
+// timestampLinePattern matches transcript lines such as "[00:01:02] ..." or "01:02 ..."
+var timestampLinePattern = regexp.MustCompile(`^\s*[\[(]?\d{1,2}:\d{2}(?::\d{2})?(?:[.,]\d+)?[\])]?\s`)
+
+// SummaryResult is a generated summary together with how it was produced
+type SummaryResult struct {
+	Summary  string
+	Strategy string
+	Chunks   int
+}
+
+// GenerateSummary generates a summary of provided text using AI. Text that fits the
+// model's context window is summarized in one prompt; longer text is split into chunks
+// that are summarized concurrently and then combined (map-reduce).
+func (as *AIService) GenerateSummary(text string, length string) (*SummaryResult, error) {
+	budget := as.inputBudget()
+
+	if as.provider.EstimateTokens(text) <= budget {
+		summary, err := as.PromptAI(fmt.Sprintf("Generate a %s summary of the following text.%s\n\n%s", length, as.languageInstruction(), text))
+		if err != nil {
+			return nil, err
+		}
+		return &SummaryResult{Summary: summary, Strategy: SummaryStrategyStuff, Chunks: 1}, nil
+	}
+
+	chunks := splitForBudget(text, budget, as.provider.EstimateTokens)
+	if len(chunks) > maxSummaryChunks {
+		return nil, fmt.Errorf("%w: it needs %d parts, at most %d are allowed", ErrContentTooLarge, len(chunks), maxSummaryChunks)
+	}
+	partials, err := as.summarizeAll(chunks, func(i int, chunk string) string {
+		return fmt.Sprintf("The following is part %d of %d of a longer text. Summarize this part, keeping key facts, "+
+			"names, numbers and timestamps:\n\n%s", i+1, len(chunks), chunk)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := as.reduceSummaries(partials, length, budget)
+	if err != nil {
+		return nil, err
+	}
+	return &SummaryResult{Summary: summary, Strategy: SummaryStrategyMapReduce, Chunks: len(chunks)}, nil
+}
+
+// reduceSummaries combines partial summaries into one, collapsing them in groups first
+// while they are still too long for a single prompt
+func (as *AIService) reduceSummaries(partials []string, length string, budget int) (string, error) {
+	for round := 0; as.provider.EstimateTokens(joinSummaries(partials)) > budget; round++ {
+		if round == maxReduceRounds {
+			return "", fmt.Errorf("partial summaries are still too long for the model after %d reduce rounds", maxReduceRounds)
+		}
+
+		groups := packUnits(partials, "\n\n", budget, as.provider.EstimateTokens)
+		collapsed, err := as.summarizeAll(groups, func(_ int, group string) string {
+			return fmt.Sprintf("Condense the following partial summaries of one longer text into a single summary, "+
+				"keeping key facts, names, numbers and timestamps:\n\n%s", group)
+		})
+		if err != nil {
+			return "", err
+		}
+		partials = collapsed
+	}
+
+	return as.PromptAI(fmt.Sprintf("The following are summaries of consecutive parts of one longer text. "+
+		"Combine them into a single, coherent %s summary of the whole text without repeating yourself.%s\n\n%s",
+		length, as.languageInstruction(), joinSummaries(partials)))
+}
+
+// summarizeAll prompts the AI for every chunk concurrently, preserving order
+func (as *AIService) summarizeAll(chunks []string, prompt func(i int, chunk string) string) ([]string, error) {
+	results := make([]string, len(chunks))
+	err := runBounded(len(chunks), as.summaryConcurrency, func(i int) error {
+		summary, err := as.PromptAI(prompt(i, chunks[i]))
+		if err != nil {
+			return fmt.Errorf("chunk %d of %d: %w", i+1, len(chunks), err)
+		}
+		results[i] = summary
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// inputBudget is the number of text tokens that fit in one prompt for the configured model
+func (as *AIService) inputBudget() int {
+	return max(as.provider.ContextWindow()-providers.MaxOutputTokens-promptOverheadTokens, promptOverheadTokens)
+}
+
+// splitForBudget splits text into chunks that each fit in budget tokens. Timestamped
+// transcripts are split between lines, everything else between sentences.
+func splitForBudget(text string, budget int, estimate func(string) int) []string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+
+	timestamped := 0
+	for _, line := range lines {
+		if timestampLinePattern.MatchString(line) {
+			timestamped++
+		}
+	}
+
+	if timestamped > len(lines)/2 {
+		return packUnits(lines, "\n", budget, estimate)
+	}
+	return packUnits(splitSentences(text), " ", budget, estimate)
+}
+
+// packUnits greedily joins consecutive units with sep into chunks of at most budget
+// tokens. Units that are too large on their own are split between words.
+func packUnits(units []string, sep string, budget int, estimate func(string) int) []string {
+	var chunks []string
+	var current []string
+	currentTokens := 0
+
+	flush := func() {
+		if len(current) > 0 {
+			chunks = append(chunks, strings.Join(current, sep))
+			current, currentTokens = nil, 0
+		}
+	}
+
+	for _, unit := range units {
+		tokens := estimate(unit)
+		if tokens > budget {
+			flush()
+			chunks = append(chunks, splitWords(unit, budget, estimate)...)
+			continue
+		}
+		if currentTokens+tokens > budget {
+			flush()
+		}
+		current = append(current, unit)
+		currentTokens += tokens
+	}
+	flush()
+
+	return chunks
+}
+
+// splitWords splits text between words into pieces of at most budget tokens
+func splitWords(text string, budget int, estimate func(string) int) []string {
+	var pieces []string
+	var current []string
+	currentTokens := 0
+
+	for _, word := range strings.Fields(text) {
+		tokens := estimate(word)
+		if currentTokens+tokens > budget && len(current) > 0 {
+			pieces = append(pieces, strings.Join(current, " "))
+			current, currentTokens = nil, 0
+		}
+		current = append(current, word)
+		currentTokens += tokens
+	}
+	if len(current) > 0 {
+		pieces = append(pieces, strings.Join(current, " "))
+	}
+	return pieces
+}
+
+// splitSentences splits text after sentence-ending punctuation followed by whitespace
+func splitSentences(text string) []string {
+	var sentences []string
+	runes := []rune(text)
+	start := 0
+
+	for i, r := range runes {
+		if !strings.ContainsRune(".!?", r) || (i+1 < len(runes) && !unicode.IsSpace(runes[i+1])) {
+			continue
+		}
+		if sentence := strings.TrimSpace(string(runes[start : i+1])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = i + 1
+	}
+	if rest := strings.TrimSpace(string(runes[start:])); rest != "" {
+		sentences = append(sentences, rest)
+	}
+
+	return sentences
+}
+
+func joinSummaries(summaries []string) string {
+	parts := make([]string, len(summaries))
+	for i, summary := range summaries {
+		parts[i] = fmt.Sprintf("Part %d:\n%s", i+1, strings.TrimSpace(summary))
+	}
+	return strings.Join(parts, "\n\n")
+}
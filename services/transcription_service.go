@@ -0,0 +1,223 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"sample-api/config"
+	"sample-api/models"
+	"sample-api/services/providers"
+)
+
+const (
+	// maxOverlapWords bounds how far back duplicated words are searched at chunk joins
+	maxOverlapWords = 20
+)
+
+// TranscriptionService transcribes audio of any length by splitting it into
+// overlapping chunks that fit the speech-to-text API limits
+type TranscriptionService struct {
+	aiService    *AIService
+	audioService *AudioService
+	chunkLength  float64
+	overlap      float64
+	concurrency  int
+}
+
+// NewTranscriptionService creates a new transcription service with the configured chunking
+func NewTranscriptionService(aiService *AIService, audioService *AudioService, cfg config.TranscriptionConfig) *TranscriptionService {
+	return &TranscriptionService{
+		aiService:    aiService,
+		audioService: audioService,
+		chunkLength:  float64(cfg.ChunkSeconds),
+		overlap:      float64(cfg.OverlapSeconds),
+		concurrency:  cfg.Concurrency,
+	}
+}
+
+// WithAIService returns a copy of the service that uses aiService, e.g. one scoped to an
+// organization's credentials
+func (ts *TranscriptionService) WithAIService(aiService *AIService) *TranscriptionService {
+	scoped := *ts
+	scoped.aiService = aiService
+	return &scoped
+}
+
+// Transcribe transcribes the audio file at path, chunking it when it is longer than the chunk length
+func (ts *TranscriptionService) Transcribe(path string, language string) (*models.Transcript, error) {
+	duration, err := ts.audioService.Duration(path)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := overlappingChunkPlan(duration, ts.chunkLength, ts.overlap)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]*providers.Transcription, len(plan))
+
+	if len(plan) == 1 {
+		parts[0], err = ts.aiService.TranscribeAudio(path, language)
+		if err != nil {
+			return nil, err
+		}
+	} else if err := ts.transcribeChunks(path, language, plan, parts); err != nil {
+		return nil, err
+	}
+
+	transcript := &models.Transcript{
+		Duration: duration,
+		Chunks:   len(plan),
+		Segments: mergeTranscriptions(plan, parts),
+	}
+
+	texts := make([]string, 0, len(transcript.Segments))
+	for _, segment := range transcript.Segments {
+		texts = append(texts, segment.Text)
+	}
+	transcript.Text = strings.Join(texts, " ")
+
+	for _, part := range parts {
+		if part.Language != "" {
+			transcript.Language = part.Language
+			break
+		}
+	}
+
+	return transcript, nil
+}
+
+// transcribeChunks cuts and transcribes each planned chunk using a bounded worker pool
+func (ts *TranscriptionService) transcribeChunks(path string, language string, plan []AudioSegment, parts []*providers.Transcription) error {
+	return runBounded(len(plan), ts.concurrency, func(i int) error {
+		segment := plan[i]
+		part, err := ts.transcribeChunk(path, language, segment)
+		if err != nil {
+			return fmt.Errorf("chunk %d (%.0fs-%.0fs): %w", i+1, segment.Start, segment.Start+segment.Duration, err)
+		}
+		parts[i] = part
+		return nil
+	})
+}
+
+func (ts *TranscriptionService) transcribeChunk(path string, language string, segment AudioSegment) (*providers.Transcription, error) {
+	chunkPath, err := ts.audioService.Cut(path, segment.Start, segment.Duration)
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(chunkPath)
+
+	return ts.aiService.TranscribeAudio(chunkPath, language)
+}
+
+// overlappingChunkPlan splits duration into chunks of at most length seconds where
+// each chunk repeats the last overlap seconds of the previous one. Chunks must advance,
+// so the overlap has to be shorter than the chunks.
+func overlappingChunkPlan(duration float64, length float64, overlap float64) ([]AudioSegment, error) {
+	if overlap < 0 || !(length-overlap > 0) {
+		return nil, fmt.Errorf("invalid chunking: %gs chunks cannot overlap by %gs", length, overlap)
+	}
+
+	var plan []AudioSegment
+	for start := 0.0; ; start += length - overlap {
+		plan = append(plan, AudioSegment{
+			Start:    start,
+			Duration: math.Min(length, duration-start),
+		})
+		if start+length >= duration {
+			return plan, nil
+		}
+	}
+}
+
+// mergeTranscriptions shifts chunk timestamps to the global timeline and stitches the
+// chunks together. Each overlap is split at its midpoint: the earlier chunk keeps segments
+// centred before it and the later chunk keeps segments that end after it. Words repeated
+// on both sides of a join are dropped from the later chunk.
+func mergeTranscriptions(plan []AudioSegment, parts []*providers.Transcription) []models.TranscriptSegment {
+	merged := []models.TranscriptSegment{}
+
+	for i, part := range parts {
+		chunk := plan[i]
+
+		lower := math.Inf(-1)
+		if i > 0 {
+			lower = (chunk.Start + plan[i-1].Start + plan[i-1].Duration) / 2
+		}
+		upper := math.Inf(1)
+		if i+1 < len(plan) {
+			upper = (plan[i+1].Start + chunk.Start + chunk.Duration) / 2
+		}
+
+		segments := part.Segments
+		if len(segments) == 0 && strings.TrimSpace(part.Text) != "" {
+			segments = []providers.TranscriptionSegment{{Start: 0, End: chunk.Duration, Text: part.Text}}
+		}
+
+		joined := false
+		for _, segment := range segments {
+			start := segment.Start + chunk.Start
+			end := segment.End + chunk.Start
+			if mid := (start + end) / 2; end <= lower || mid >= upper {
+				continue
+			}
+
+			text := strings.TrimSpace(segment.Text)
+			if !joined && len(merged) > 0 {
+				text = trimRepeatedWords(merged[len(merged)-1].Text, text)
+			}
+			joined = true
+			if text == "" {
+				continue
+			}
+
+			// Keep timestamps monotonic across joins
+			if len(merged) > 0 && start < merged[len(merged)-1].End {
+				start = merged[len(merged)-1].End
+			}
+			if end < start {
+				end = start
+			}
+
+			merged = append(merged, models.TranscriptSegment{
+				Start: start,
+				End:   end,
+				Text:  text,
+			})
+		}
+	}
+
+	return merged
+}
+
+// trimRepeatedWords removes the longest run of words at the start of next that
+// repeats the end of prev
+func trimRepeatedWords(prev string, next string) string {
+	prevWords := strings.Fields(prev)
+	nextWords := strings.Fields(next)
+
+	maxWords := min(len(prevWords), len(nextWords), maxOverlapWords)
+	// Require at least two words so that a legitimately repeated word is kept
+	for k := maxWords; k >= 2; k-- {
+		match := true
+		for j := 0; j < k; j++ {
+			if normalizeWord(prevWords[len(prevWords)-k+j]) != normalizeWord(nextWords[j]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return strings.Join(nextWords[k:], " ")
+		}
+	}
+	return next
+}
+
+func normalizeWord(word string) string {
+	return strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSymbol(r)
+	}))
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOverlappingChunkPlan(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration float64
+		length   float64
+		overlap  float64
+		want     []AudioSegment
+		wantErr  bool
+	}{
+		{
+			name:     "shorter than one chunk",
+			duration: 30, length: 60, overlap: 5,
+			want: []AudioSegment{{Start: 0, Duration: 30}},
+		},
+		{
+			name:     "exactly one chunk",
+			duration: 60, length: 60, overlap: 5,
+			want: []AudioSegment{{Start: 0, Duration: 60}},
+		},
+		{
+			name:     "overlapping chunks",
+			duration: 130, length: 60, overlap: 10,
+			want: []AudioSegment{{Start: 0, Duration: 60}, {Start: 50, Duration: 60}, {Start: 100, Duration: 30}},
+		},
+		{
+			name:     "without overlap",
+			duration: 120, length: 60, overlap: 0,
+			want: []AudioSegment{{Start: 0, Duration: 60}, {Start: 60, Duration: 60}},
+		},
+		{name: "overlap as long as the chunks", duration: 120, length: 60, overlap: 60, wantErr: true},
+		{name: "overlap longer than the chunks", duration: 120, length: 60, overlap: 90, wantErr: true},
+		{name: "zero length", duration: 120, length: 0, overlap: 0, wantErr: true},
+		{name: "negative overlap", duration: 120, length: 60, overlap: -10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := overlappingChunkPlan(tt.duration, tt.length, tt.overlap)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("overlappingChunkPlan = %v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("overlappingChunkPlan: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("overlappingChunkPlan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"sample-api/models"
+
+	"gorm.io/gorm"
+)
+
+// UserCredentialService stores users' own provider API keys, encrypted at rest
+type UserCredentialService struct {
+	db        *gorm.DB
+	encryptor *Encryptor
+}
+
+// NewUserCredentialService creates a new user credential service
+func NewUserCredentialService(db *gorm.DB, encryptor *Encryptor) *UserCredentialService {
+	return &UserCredentialService{
+		db:        db,
+		encryptor: encryptor,
+	}
+}
+
+// Set stores or replaces the user's API key for a provider
+func (s *UserCredentialService) Set(userID uint, provider string, req models.SetCredentialRequest) (models.UserCredential, error) {
+	if !IsKnownProvider(provider) {
+		return models.UserCredential{}, ErrUnknownProvider
+	}
+	if !IsKnownModel(provider, req.Model) {
+		return models.UserCredential{}, ErrUnknownModel
+	}
+
+	sealed, err := s.encryptor.Seal(req.APIKey, credentialContext(userID, provider))
+	if err != nil {
+		return models.UserCredential{}, err
+	}
+
+	var credential models.UserCredential
+	err = s.db.Where("user_id = ? AND provider = ?", userID, provider).First(&credential).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return models.UserCredential{}, err
+	}
+
+	credential.UserID = userID
+	credential.Provider = provider
+	credential.Key = sealed
+	credential.KeyHint = keyHint(req.APIKey)
+	credential.Model = req.Model
+	if err := s.db.Save(&credential).Error; err != nil {
+		return models.UserCredential{}, err
+	}
+	return credential, nil
+}
+
+// List returns the user's provider credentials without their keys
+func (s *UserCredentialService) List(userID uint) ([]models.UserCredential, error) {
+	var credentials []models.UserCredential
+	err := s.db.Where("user_id = ?", userID).Order("provider").Find(&credentials).Error
+	return credentials, err
+}
+
+// Delete removes the user's API key for a provider
+func (s *UserCredentialService) Delete(userID uint, provider string) error {
+	result := s.db.Where("user_id = ? AND provider = ?", userID, provider).Delete(&models.UserCredential{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCredentialNotFound
+	}
+	return nil
+}
+
+// Key returns the user's decrypted API key and preferred model for a provider. ok is
+// false when the user has not stored a key for it.
+func (s *UserCredentialService) Key(userID uint, provider string) (apiKey string, model string, ok bool, err error) {
+	var credential models.UserCredential
+	err = s.db.Where("user_id = ? AND provider = ?", userID, provider).First(&credential).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, err
+	}
+
+	apiKey, err = s.encryptor.Open(credential.Key, credentialContext(userID, provider))
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to read %s key %s of user %d: %w", provider, credential.KeyHint, userID, err)
+	}
+	return apiKey, credential.Model, true, nil
+}
+
+// credentialContext binds an encrypted key to its owner and provider so it cannot be
+// copied to another row
+func credentialContext(userID uint, provider string) string {
+	return fmt.Sprintf("user_credential:%d:%s", userID, provider)
+}
@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"sample-api/models"
+
+	"gorm.io/gorm"
+)
+
+// exportBatchSize is how many users are loaded at a time while streaming an export
+const exportBatchSize = 500
+
+// errRollbackImport aborts the import transaction without reporting a failure
+var errRollbackImport = errors.New("rollback import")
+
+// ImportUsers creates users from parsed import rows in one transaction. In atomic mode
+// nothing is committed unless every row succeeds; in best-effort mode failing rows are
+// skipped. A dry run reports what would happen and always rolls back.
+func (s *UserService) ImportUsers(rows []models.UserImportRow, mode string, dryRun bool) (*models.UserImportResponse, error) {
+	response := &models.UserImportResponse{
+		Mode:    mode,
+		DryRun:  dryRun,
+		Total:   len(rows),
+		Results: make([]models.UserImportResult, len(rows)),
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for i, row := range rows {
+			result := &response.Results[i]
+			result.Line = row.Line
+			result.Email = row.User.Email
+
+			if len(row.Errors) > 0 {
+				result.Status = models.ImportStatusInvalid
+				result.Errors = row.Errors
+				response.Failed++
+				continue
+			}
+
+			// A savepoint per row lets the transaction continue after a failed insert
+			savepoint := fmt.Sprintf("import_row_%d", i)
+			if err := tx.SavePoint(savepoint).Error; err != nil {
+				return err
+			}
+			user, err := s.createUser(tx, models.User{Name: row.User.Name, Email: row.User.Email, Role: row.User.Role})
+			if err != nil {
+				if rollbackErr := tx.RollbackTo(savepoint).Error; rollbackErr != nil {
+					return rollbackErr
+				}
+				var conflict *ConflictError
+				if !errors.As(err, &conflict) {
+					return err
+				}
+				result.Status = models.ImportStatusConflict
+				result.Errors = []models.FieldError{{Field: conflict.Field, Code: "conflict", Message: conflict.Error()}}
+				response.Failed++
+				continue
+			}
+
+			result.Status = models.ImportStatusCreated
+			result.UserID = user.ID
+		}
+
+		if dryRun || (mode == models.ImportModeAtomic && response.Failed > 0) {
+			return errRollbackImport
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errRollbackImport) {
+		return nil, err
+	}
+	response.Committed = err == nil
+
+	for i := range response.Results {
+		result := &response.Results[i]
+		if result.Status != models.ImportStatusCreated {
+			continue
+		}
+		switch {
+		case response.Committed:
+			response.Created++
+		case dryRun:
+			result.Status = models.ImportStatusValid
+			result.UserID = 0
+		default:
+			result.Status = models.ImportStatusSkipped
+			result.UserID = 0
+		}
+	}
+
+	return response, nil
+}
+
+// ExportUsers loads all users in id order and passes them to fn in batches, so large
+// exports can be streamed without holding every user in memory
+func (s *UserService) ExportUsers(fn func(users []models.User) error) error {
+	var batch []models.User
+	return s.db.Order("id").FindInBatches(&batch, exportBatchSize, func(tx *gorm.DB, _ int) error {
+		return fn(batch)
+	}).Error
+}
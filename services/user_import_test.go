@@ -0,0 +1,94 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"sample-api/config"
+	"sample-api/models"
+)
+
+func TestUserServiceImportUsers(t *testing.T) {
+	row := func(line int, email string, errors ...models.FieldError) models.UserImportRow {
+		return models.UserImportRow{Line: line, User: models.CreateUserRequest{Name: "User", Email: email}, Errors: errors}
+	}
+	invalid := models.FieldError{Field: "email", Code: "invalid_email", Message: "must be a valid email address"}
+	rows := []models.UserImportRow{
+		row(2, "new@example.com"),
+		row(3, "taken@example.com"),
+		row(4, "bad", invalid),
+		row(5, "new@example.com"), // the same address twice in one file
+		row(6, "other@example.com"),
+	}
+
+	tests := []struct {
+		name          string
+		mode          string
+		dryRun        bool
+		wantStatuses  []string
+		wantCommitted bool
+		wantCreated   int
+	}{
+		{
+			name: "atomic import with failing rows",
+			mode: models.ImportModeAtomic,
+			wantStatuses: []string{models.ImportStatusSkipped, models.ImportStatusConflict, models.ImportStatusInvalid,
+				models.ImportStatusConflict, models.ImportStatusSkipped},
+		},
+		{
+			name: "best effort import",
+			mode: models.ImportModeBestEffort,
+			wantStatuses: []string{models.ImportStatusCreated, models.ImportStatusConflict, models.ImportStatusInvalid,
+				models.ImportStatusConflict, models.ImportStatusCreated},
+			wantCommitted: true,
+			wantCreated:   2,
+		},
+		{
+			name:   "dry run",
+			mode:   models.ImportModeBestEffort,
+			dryRun: true,
+			wantStatuses: []string{models.ImportStatusValid, models.ImportStatusConflict, models.ImportStatusInvalid,
+				models.ImportStatusConflict, models.ImportStatusValid},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := NewUserService(newTestDB(t), config.AuthConfig{})
+			if _, err := users.CreateUser(models.User{Name: "Taken", Email: "taken@example.com"}); err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			response, err := users.ImportUsers(rows, tt.mode, tt.dryRun)
+			if err != nil {
+				t.Fatalf("ImportUsers: %v", err)
+			}
+
+			var statuses []string
+			for i, result := range response.Results {
+				statuses = append(statuses, result.Status)
+				if result.Line != rows[i].Line {
+					t.Errorf("result %d is for line %d, want %d", i, result.Line, rows[i].Line)
+				}
+				if (result.UserID != 0) != (result.Status == models.ImportStatusCreated) {
+					t.Errorf("line %d: status %s with user ID %d", result.Line, result.Status, result.UserID)
+				}
+			}
+			if !reflect.DeepEqual(statuses, tt.wantStatuses) {
+				t.Errorf("statuses = %v, want %v", statuses, tt.wantStatuses)
+			}
+			if response.Committed != tt.wantCommitted || response.Created != tt.wantCreated || response.Failed != 3 {
+				t.Errorf("committed, created, failed = %v, %d, %d, want %v, %d, 3",
+					response.Committed, response.Created, response.Failed, tt.wantCommitted, tt.wantCreated)
+			}
+
+			page, err := users.ListUsers(ListQuery{})
+			if err != nil {
+				t.Fatalf("ListUsers: %v", err)
+			}
+			if page.Total != int64(1+tt.wantCreated) {
+				t.Errorf("%d users stored, want %d", page.Total, 1+tt.wantCreated)
+			}
+		})
+	}
+}
@@ -2,38 +2,206 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"sample-api/config"
 	"sample-api/models"
+	"slices"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
 
+var (
+	ErrUserNotFound   = errors.New("user not found")
+	ErrEmailTaken     = errors.New("email already exists")
+	ErrUserNotDeleted = errors.New("user is not deleted")
+)
+
 type UserService struct {
-	db *gorm.DB
+	db          *gorm.DB
+	adminEmails []string
 }
 
-func NewUserService(db *gorm.DB) *UserService {
+// NewUserService creates a new user service. Users whose email is listed in
+// cfg.AdminEmails are given the admin role once they have verified the address.
+func NewUserService(db *gorm.DB, cfg config.AuthConfig) *UserService {
+	var adminEmails []string
+	for _, email := range cfg.AdminEmails {
+		if email = strings.TrimSpace(email); email != "" {
+			adminEmails = append(adminEmails, strings.ToLower(email))
+		}
+	}
+
 	return &UserService{
-		db: db,
+		db:          db,
+		adminEmails: adminEmails,
 	}
 }
 
-func (s *UserService) GetUsers() ([]models.User, error) {
-	var users []models.User
-	if err := s.db.Find(&users).Error; err != nil {
-		return nil, err
+// PromoteAdmins gives the admin role to existing users listed as admin emails
+func (s *UserService) PromoteAdmins() error {
+	return s.promoteAdmins(s.db)
+}
+
+// promoteAdmins gives the admin role to the users in db's scope whose address is an
+// admin email. Only verified addresses count: anyone can claim an address at signup.
+func (s *UserService) promoteAdmins(db *gorm.DB) error {
+	if len(s.adminEmails) == 0 {
+		return nil
+	}
+	return db.Model(&models.User{}).
+		Where("LOWER(email) IN ? AND email_verified_at IS NOT NULL", s.adminEmails).
+		Update("role", models.RoleAdmin).Error
+}
+
+// userListSpec is what GET /users allows clients to sort and search by
+var userListSpec = ListSpec{
+	SortColumns: []string{"id", "name", "email", "created_at", "updated_at"},
+	DefaultSort: "id",
+	SearchColumns: map[string]string{
+		"name":  "name",
+		"email": "email",
+	},
+}
+
+func (s *UserService) ListUsers(q ListQuery) (models.Page[models.User], error) {
+	return Paginate[models.User](s.db, userListSpec, q)
+}
+
+func (s *UserService) GetUser(id uint) (models.User, error) {
+	var user models.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		return models.User{}, translateUserError(err)
 	}
-	return users, nil
+	return user, nil
 }
 
+// CreateUser creates a user. The unique index on email (which soft-deleted users still
+// hold) decides whether the address is taken, so concurrent signups cannot both succeed.
 func (s *UserService) CreateUser(user models.User) (models.User, error) {
-	// Check if email already exists
-	var existingUser models.User
-	if err := s.db.Where("email = ?", user.Email).First(&existingUser).Error; err == nil {
-		return models.User{}, errors.New("email already exists")
+	return s.createUser(s.db, user)
+}
+
+func (s *UserService) createUser(db *gorm.DB, user models.User) (models.User, error) {
+	if user.EmailVerifiedAt != nil && slices.Contains(s.adminEmails, strings.ToLower(user.Email)) {
+		user.Role = models.RoleAdmin
+	} else if user.Role == "" {
+		user.Role = models.RoleMember
+	}
+
+	if err := db.Create(&user).Error; err != nil {
+		return models.User{}, translateUserError(err)
+	}
+	return user, nil
+}
+
+func (s *UserService) UpdateUser(id uint, req models.UpdateUserRequest) (models.User, error) {
+	user, err := s.GetUser(id)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if req.Name != nil {
+		user.Name = *req.Name
+	}
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	if emailChanged {
+		user.Email = *req.Email
+		// A new address has to be verified again
+		user.EmailVerifiedAt = nil
 	}
+	if req.Role != nil {
+		user.Role = *req.Role
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&user).Error; err != nil {
+			return translateUserError(err)
+		}
+		if !emailChanged {
+			return nil
+		}
+		// Links sent to the old address must not verify the new one or reset its password
+		return tx.Model(&models.UserToken{}).
+			Where("user_id = ? AND used_at IS NULL", user.ID).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+	return user, nil
+}
+
+// UpdatePreferences replaces a user's AI preferences. A model preferred without a
+// provider is checked when it is used, against whichever provider then applies.
+func (s *UserService) UpdatePreferences(id uint, prefs models.UserPreferences) (models.UserPreferences, error) {
+	// A model is only valid for one provider, so it cannot be preferred on its own
+	if prefs.Model != "" && prefs.Provider == "" {
+		return models.UserPreferences{}, fmt.Errorf("%w: a preferred model needs a preferred provider", ErrUnknownModel)
+	}
+	if !IsKnownModel(prefs.Provider, prefs.Model) {
+		return models.UserPreferences{}, ErrUnknownModel
+	}
+	result := s.db.Model(&models.User{}).Where("id = ?", id).
+		Select("preferences").Updates(&models.User{Preferences: prefs})
+	if result.Error != nil {
+		return models.UserPreferences{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return models.UserPreferences{}, ErrUserNotFound
+	}
+	return prefs, nil
+}
+
+// DeleteUser soft-deletes a user; it can be brought back with RestoreUser
+func (s *UserService) DeleteUser(id uint) error {
+	result := s.db.Delete(&models.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
 
-	if err := s.db.Create(&user).Error; err != nil {
+// RestoreUser undoes a soft delete
+func (s *UserService) RestoreUser(id uint) (models.User, error) {
+	var user models.User
+	if err := s.db.Unscoped().First(&user, id).Error; err != nil {
+		return models.User{}, translateUserError(err)
+	}
+	if !user.DeletedAt.Valid {
+		return models.User{}, ErrUserNotDeleted
+	}
+
+	if err := s.db.Unscoped().Model(&user).Update("deleted_at", nil).Error; err != nil {
 		return models.User{}, err
 	}
+	user.DeletedAt = gorm.DeletedAt{}
 	return user, nil
 }
+
+// PurgeUser permanently removes a user, whether or not it was soft-deleted
+func (s *UserService) PurgeUser(id uint) error {
+	result := s.db.Unscoped().Delete(&models.User{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func translateUserError(err error) error {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrUserNotFound
+	case isUniqueViolation(err):
+		// email is the only unique column on users
+		return &ConflictError{Field: "email", Err: ErrEmailTaken}
+	}
+	return err
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"sample-api/config"
+	"sample-api/models"
+
+	"gorm.io/gorm"
+)
+
+func TestUserServiceUpdatePreferences(t *testing.T) {
+	tests := []struct {
+		name    string
+		prefs   models.UserPreferences
+		wantErr error
+	}{
+		{name: "no model", prefs: models.UserPreferences{Provider: "anthropic"}},
+		{name: "model of the preferred provider", prefs: models.UserPreferences{Provider: "anthropic", Model: "claude-3-5-haiku-latest"}},
+		{name: "model of another provider", prefs: models.UserPreferences{Provider: "anthropic", Model: "gpt-4o"}, wantErr: ErrUnknownModel},
+		{name: "model without a provider", prefs: models.UserPreferences{Model: "gpt-4o"}, wantErr: ErrUnknownModel},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := NewUserService(newTestDB(t), config.AuthConfig{})
+			user, err := users.CreateUser(models.User{Name: "Member", Email: "member@example.com"})
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			_, err = users.UpdatePreferences(user.ID, tt.prefs)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("UpdatePreferences error = %v, want %v", err, tt.wantErr)
+			}
+			got, err := users.GetUser(user.ID)
+			if err != nil {
+				t.Fatalf("GetUser: %v", err)
+			}
+			if saved := got.Preferences.Model == tt.prefs.Model; saved != (tt.wantErr == nil) {
+				t.Errorf("model saved = %v, want %v", saved, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestUserServiceEmailConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		// act makes a second account use the address of owner
+		act func(users *UserService, owner models.User) error
+	}{
+		{
+			name: "create",
+			act: func(users *UserService, owner models.User) error {
+				_, err := users.CreateUser(models.User{Name: "Other", Email: owner.Email})
+				return err
+			},
+		},
+		{
+			name: "update",
+			act: func(users *UserService, owner models.User) error {
+				other, err := users.CreateUser(models.User{Name: "Other", Email: "other@example.com"})
+				if err != nil {
+					return err
+				}
+				_, err = users.UpdateUser(other.ID, models.UpdateUserRequest{Email: &owner.Email})
+				return err
+			},
+		},
+		{
+			name: "address of a deleted user",
+			act: func(users *UserService, owner models.User) error {
+				if err := users.DeleteUser(owner.ID); err != nil {
+					return err
+				}
+				_, err := users.CreateUser(models.User{Name: "Other", Email: owner.Email})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			users := NewUserService(newTestDB(t), config.AuthConfig{})
+			owner, err := users.CreateUser(models.User{Name: "Member", Email: "member@example.com"})
+			if err != nil {
+				t.Fatalf("CreateUser: %v", err)
+			}
+
+			err = tt.act(users, owner)
+			var conflict *ConflictError
+			if !errors.As(err, &conflict) || conflict.Field != "email" {
+				t.Fatalf("error = %v, want a conflict on email", err)
+			}
+			if !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("error = %v, want it to wrap %v", err, ErrEmailTaken)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: gorm.ErrDuplicatedKey, want: true},
+		{err: fmt.Errorf("insert: %w", gorm.ErrDuplicatedKey), want: true},
+		{err: errors.New("UNIQUE constraint failed: users.email"), want: true},
+		{err: errors.New(`ERROR: duplicate key value violates unique constraint "idx_users_email" (SQLSTATE 23505)`), want: true},
+		{err: errors.New("Error 1062 (23000): Duplicate entry 'a@example.com' for key 'users.idx_users_email'"), want: true},
+		{err: errors.New("NOT NULL constraint failed: users.name"), want: false},
+		{err: gorm.ErrRecordNotFound, want: false},
+		{err: nil, want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err); got != tt.want {
+			t.Errorf("isUniqueViolation(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -1,36 +1,66 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"sync"
 	"time"
 
-	"github.com/gin-gonic/gin"
+	"sample-api/metrics"
+
 	"github.com/google/uuid"
 )
 
+var ErrShuttingDown = errors.New("server is shutting down, try again later")
+
 type YouTubeService struct {
 	tempDir string
+
+	// ctx is cancelled to kill running extractions when the server stops
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	draining bool
 }
 
 func NewYouTubeService() *YouTubeService {
 	tempDir := filepath.Join(os.TempDir(), "youtube_audio")
 	os.MkdirAll(tempDir, 0755)
+	ctx, cancel := context.WithCancel(context.Background())
 	return &YouTubeService{
 		tempDir: tempDir,
+		ctx:     ctx,
+		cancel:  cancel,
 	}
 }
 
-func (ys *YouTubeService) ExtractAudio(url string) (string, error) {
+// ExtractAudio downloads the audio of a video as MP3. yt-dlp is killed when ctx is done,
+// e.g. because the client went away, or when running extractions are cancelled.
+func (ys *YouTubeService) ExtractAudio(ctx context.Context, url string) (string, error) {
+	ys.mu.Lock()
+	draining := ys.draining
+	ys.mu.Unlock()
+	if draining {
+		return "", ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(ys.ctx, cancel)
+	defer stop()
+
 	// Generate unique filename
 	fileID := uuid.New().String()
 	outputPath := filepath.Join(ys.tempDir, fmt.Sprintf("%s.mp3", fileID))
 
 	// yt-dlp command to extract audio as MP3
-	cmd := exec.Command("yt-dlp",
+	cmd := exec.CommandContext(ctx, "yt-dlp",
 		"--extract-audio",
 		"--audio-format", "mp3",
 		"--audio-quality", "192K",
@@ -38,45 +68,75 @@ func (ys *YouTubeService) ExtractAudio(url string) (string, error) {
 		"--no-playlist",
 		url,
 	)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = 5 * time.Second
 
 	// Execute command
+	logger := slog.With("job", "yt-dlp", "file_id", fileID)
+	logger.InfoContext(ctx, "Extraction started", "url", url)
+	start := time.Now()
+	metrics.ExtractionsRunning.Inc()
 	output, err := cmd.CombinedOutput()
+	metrics.ExtractionsRunning.Dec()
+	logger.DebugContext(ctx, "yt-dlp output", "output", string(output))
 	if err != nil {
+		logger.WarnContext(ctx, "Extraction failed", "duration", time.Since(start), "error", err)
+		ys.removePartial(fileID)
+		if ctx.Err() != nil {
+			metrics.ExtractionDuration.WithLabelValues("cancelled").Observe(time.Since(start).Seconds())
+		} else {
+			metrics.ExtractionDuration.WithLabelValues("failure").Observe(time.Since(start).Seconds())
+		}
+		if ys.ctx.Err() != nil {
+			return "", ErrShuttingDown
+		}
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("yt-dlp was stopped: %w", ctx.Err())
+		}
 		return "", fmt.Errorf("yt-dlp failed: %v, output: %s", err, string(output))
 	}
 
 	// Verify file was created
 	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		metrics.ExtractionDuration.WithLabelValues("failure").Observe(time.Since(start).Seconds())
 		return "", fmt.Errorf("audio file was not created")
 	}
 
+	metrics.ExtractionDuration.WithLabelValues("success").Observe(time.Since(start).Seconds())
+	logger.InfoContext(ctx, "Extraction finished", "duration", time.Since(start))
 	return outputPath, nil
 }
 
-func (ys *YouTubeService) ServeAudioFile(c *gin.Context, filePath string) error {
-	// Get filename from path
-	filename := filepath.Base(filePath)
-	if !strings.HasSuffix(filename, ".mp3") {
-		filename += ".mp3"
-	}
-
-	// Set headers for file download
-	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
-	c.Header("Content-Type", "audio/mpeg")
-	c.Header("Content-Transfer-Encoding", "binary")
-
-	// Serve the file
-	c.File(filePath)
-
-	// Clean up file after serving (with delay to ensure download completes)
-	go func() {
-		time.Sleep(10 * time.Second)
-		os.Remove(filePath)
-	}()
+// Drain makes new extractions fail with ErrShuttingDown; running ones continue
+func (ys *YouTubeService) Drain() {
+	ys.mu.Lock()
+	ys.draining = true
+	ys.mu.Unlock()
+}
 
-	return nil
+// Cancel kills all running extractions
+func (ys *YouTubeService) Cancel() {
+	ys.Drain()
+	ys.cancel()
 }
 
+// Cleanup removes partial downloads left behind by extractions that did not finish.
+// Finished files stay until the media janitor removes them with their links.
 func (ys *YouTubeService) Cleanup() {
-	os.RemoveAll(ys.tempDir)
+	for _, pattern := range []string{"*.part", "*.ytdl", "*.temp.*"} {
+		matches, _ := filepath.Glob(filepath.Join(ys.tempDir, pattern))
+		for _, path := range matches {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to remove partial download", "path", path, "error", err)
+			}
+		}
+	}
+}
+
+// removePartial deletes whatever a failed extraction wrote
+func (ys *YouTubeService) removePartial(fileID string) {
+	matches, _ := filepath.Glob(filepath.Join(ys.tempDir, fileID+".*"))
+	for _, path := range matches {
+		os.Remove(path)
+	}
 }